@@ -0,0 +1,125 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+const (
+	appName      = "hello-world"
+	appNamespace = "default"
+	appSelector  = "workload.user.cattle.io/workloadselector=apps.deployment-default-hello-world"
+)
+
+var _ = Describe("E2E - Install a simple application", Label("install-app"), func() {
+	It("Install hello-world application on the downstream cluster(s)", func() {
+		for _, c := range cfg.Clusters() {
+			kubeconfig := GetDownstreamKubeconfig(cfg.ClusterNS, c.Name)
+
+			By("Deploying the application on "+c.Name, func() {
+				_, err := kubectl.RunWithoutErr("--kubeconfig", kubeconfig,
+					"--namespace", appNamespace, "apply", "-f", ws.Asset(appYaml))
+				Expect(err).To(Not(HaveOccurred()))
+			})
+
+			By("Waiting for the application to be rolled out on "+c.Name, func() {
+				Eventually(func() error {
+					_, err := kubectl.RunWithoutErr("--kubeconfig", kubeconfig,
+						"--namespace", appNamespace, "rollout", "status",
+						"deployment/"+appName, "--timeout=1m")
+					return err
+				}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+			})
+		}
+	})
+})
+
+var _ = Describe("E2E - Checking a simple application", Label("check-app"), func() {
+	It("Check hello-world application on the downstream cluster(s)", func() {
+		for _, c := range cfg.Clusters() {
+			var clusterIP string
+
+			kubeconfig := GetDownstreamKubeconfig(cfg.ClusterNS, c.Name)
+
+			By("Getting the service address on "+c.Name, func() {
+				out, err := kubectl.RunWithoutErr("--kubeconfig", kubeconfig,
+					"--namespace", appNamespace, "get", "service", appName,
+					"-o", "jsonpath={.spec.clusterIP}")
+				Expect(err).To(Not(HaveOccurred()))
+				clusterIP = strings.TrimSpace(out)
+				Expect(clusterIP).To(Not(BeEmpty()))
+			})
+
+			// The service must be reachable from all the nodes, whatever the node running the pods
+			// NOTE: some hosts of the range may not be used by the cluster
+			nodes := &elemental.NodeList{}
+			downstream := elemental.NewDynamic(kubeconfig)
+			err := downstream.List(elemental.KindNode, "", "", nodes)
+			Expect(err).To(Not(HaveOccurred()))
+
+			for _, n := range nodes.Items {
+				hostName := n.Metadata.Name
+				client, _ := GetNodeInfo(hostName)
+				Expect(client).To(Not(BeNil()))
+
+				By("Checking the application from "+hostName, func() {
+					out := RunSSHWithRetry(client, "curl -sf http://"+clusterIP)
+					Expect(out).To(ContainSubstring("Hello world!"))
+				})
+			}
+
+			By("Removing the application from "+c.Name, func() {
+				_, err := kubectl.RunWithoutErr("--kubeconfig", kubeconfig,
+					"--namespace", appNamespace, "delete", "--wait=false", "-f", ws.Asset(appYaml))
+				Expect(err).To(Not(HaveOccurred()))
+
+				// NOTE: the load balancer finalizer is only removed by a cloud provider, there is none here
+				out, err := kubectl.RunWithoutErr("--kubeconfig", kubeconfig,
+					"--namespace", appNamespace, "get", "service", appName+"-loadbalancer",
+					"--ignore-not-found", "-o", "name")
+				Expect(err).To(Not(HaveOccurred()))
+				if strings.TrimSpace(out) != "" {
+					_, err = kubectl.RunWithoutErr("--kubeconfig", kubeconfig,
+						"--namespace", appNamespace, "patch", "service", appName+"-loadbalancer",
+						"--type", "merge", "-p", `{"metadata":{"finalizers":null}}`)
+					Expect(err).To(Not(HaveOccurred()))
+				}
+
+				// All the resources of the application should be deleted
+				Eventually(func() string {
+					out, _ := kubectl.RunWithoutErr("--kubeconfig", kubeconfig,
+						"--namespace", appNamespace, "get", "-f", ws.Asset(appYaml),
+						"--ignore-not-found", "-o", "name")
+					return strings.TrimSpace(out)
+				}, tools.SetTimeout(3*time.Minute), 10*time.Second).Should(BeEmpty())
+
+				Eventually(func() string {
+					out, _ := kubectl.RunWithoutErr("--kubeconfig", kubeconfig,
+						"--namespace", appNamespace, "get", "pods", "--selector", appSelector,
+						"-o", "jsonpath={.items[*].metadata.name}")
+					return strings.TrimSpace(out)
+				}, tools.SetTimeout(3*time.Minute), 10*time.Second).Should(BeEmpty())
+			})
+		}
+	})
+})
@@ -0,0 +1,284 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/condition"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/network"
+	"github.com/rancher/elemental/tests/e2e/helpers/provisioning"
+	"github.com/rancher/elemental/tests/e2e/helpers/vm"
+)
+
+var _ = Describe("E2E - Bootstrapping node", Label("bootstrap"), func() {
+	var wg sync.WaitGroup
+
+	// Per-node provisioning timings, written after each spec
+	// NOTE: created when the first spec starts, the report is shared by all the specs
+	var provReport *provisioning.Report
+	BeforeEach(func() {
+		RequireVMRange()
+
+		if provReport == nil {
+			provReport = provisioning.NewReport()
+		}
+	})
+
+	writeProvisioningReport := func(last provisioning.Phase) {
+		if CurrentSpecReport().Failed() {
+			provReport.MarkFailures(last, CurrentSpecReport().Failure.Message)
+		}
+
+		err := provReport.WriteJSON(ws.Log(provisioningReportJSON))
+		Expect(err).To(Not(HaveOccurred()))
+		err = provReport.WriteJUnit(ws.Log(provisioningReportJUnit))
+		Expect(err).To(Not(HaveOccurred()))
+	}
+
+	It("Provision the node", func(ctx SpecContext) {
+		// Report to Qase
+		testCaseID = 9
+
+		// Nodes should be halted at the end of the provisioning
+		DeferCleanup(writeProvisioningReport, provisioning.PhaseShutOff)
+
+		if cfg.BootType != config.BootTypeISO {
+			By("Downloading MachineRegistration file(s)", func() {
+				for _, c := range cfg.Clusters() {
+					// Download the new YAML installation config file
+					machineRegName := "machine-registration-master-" + c.Name
+					tokenURL, err := kubectl.RunWithoutErr("get", "MachineRegistration",
+						"--namespace", cfg.ClusterNS, machineRegName,
+						"-o", "jsonpath={.status.registrationURL}")
+					Expect(err).To(Not(HaveOccurred()))
+
+					Eventually(func() error {
+						return tools.GetFileFromURL(tokenURL, ClusterInstallConfig(c.Name), false)
+					}, tools.SetTimeout(2*time.Minute), 10*time.Second).ShouldNot(HaveOccurred())
+				}
+			})
+
+			By("Configuring iPXE boot script for network installation", func() {
+				numberOfFile, err := network.ConfigureiPXE(ws.Root, httpSrv, PerNodeConfig())
+				Expect(err).To(Not(HaveOccurred()))
+				Expect(numberOfFile).To(BeNumerically(">=", 1))
+			})
+		}
+
+		// Loop on node provisionning
+		// NOTE: if VMNumbers == VMIndex then only one node will be provisionned
+		ac := NewAdmissionController()
+		for index := cfg.VMIndex; index <= cfg.VMNumbers; index++ {
+			// Set node hostname
+			hostName := elemental.SetHostname(vmNameRoot, index)
+			Expect(hostName).To(Not(BeEmpty()))
+
+			c, ok := cfg.ClusterOf(index)
+			Expect(ok).To(BeTrue())
+			client, vmOptions := PrepareNode(hostName, index, c.Name)
+			provReport.Record(hostName, provisioning.PhaseNetworkAdded)
+
+			// Wait until the host can handle one more installation
+			err := ac.Acquire(ctx)
+			Expect(err).To(Not(HaveOccurred()))
+
+			wg.Add(1)
+			go func(h string, o *vm.Options, cl *tools.Client) {
+				defer wg.Done()
+				defer GinkgoRecover()
+
+				// Free the slot even in case of failure
+				released := false
+				defer func() {
+					if !released {
+						ac.Release()
+					}
+				}()
+
+				InstallNode(o, cl, func(p provisioning.Phase) {
+					provReport.Record(h, p)
+
+					// Installation is done, another node can be started
+					if p == provisioning.PhaseInstalled {
+						ac.Release()
+						released = true
+					}
+				})
+			}(hostName, vmOptions, client)
+		}
+
+		// Wait for all parallel jobs
+		wg.Wait()
+	})
+
+	It("Add the nodes in the cluster", func(ctx SpecContext) {
+		// ElementalHosts (or MachineInventories) should be ready at the end
+		DeferCleanup(writeProvisioningReport, provisioning.PhaseHostReady)
+
+		ac := NewAdmissionController()
+		for index := cfg.VMIndex; index <= cfg.VMNumbers; index++ {
+			// Set node hostname
+			hostName := elemental.SetHostname(vmNameRoot, index)
+			Expect(hostName).To(Not(BeEmpty()))
+
+			// Get node information
+			client, _ := GetNodeInfo(hostName)
+			Expect(client).To(Not(BeNil()))
+
+			// Wait until the host can handle one more booting node
+			err := ac.Acquire(ctx)
+			Expect(err).To(Not(HaveOccurred()))
+
+			// Execute in parallel
+			wg.Add(1)
+			go func(h string, cl *tools.Client) {
+				defer wg.Done()
+				defer GinkgoRecover()
+				defer ac.Release()
+
+				StartNode(h, cl, func(p provisioning.Phase) {
+					provReport.Record(h, p)
+				})
+			}(hostName, client)
+		}
+
+		// Wait for all parallel jobs
+		wg.Wait()
+
+		hostReady := func(h string) {
+			provReport.Record(h, provisioning.PhaseHostReady)
+		}
+		if cfg.OperatorType == config.OperatorTypeVanilla {
+			checkVanillaClusters(hostReady)
+		} else {
+			checkCAPIClusters(hostReady)
+		}
+
+		if cfg.EmulateTPM {
+			By("Checking emulated TPM hashes", func() {
+				kind := elemental.KindElementalHost
+				if cfg.OperatorType == config.OperatorTypeVanilla {
+					kind = elemental.KindMachineInventory
+				}
+
+				// Each node has its own seed, so its own TPM hash
+				// NOTE: the ISO is shared by all the nodes, the seed is then randomly drawn by each node
+				// at registration, its stability is only checked when the hosts are reset with other boot types
+				hashes := map[string]string{}
+				for index := cfg.VMIndex; index <= cfg.VMNumbers; index++ {
+					hostName := elemental.SetHostname(vmNameRoot, index)
+					Expect(hostName).To(Not(BeEmpty()))
+
+					hash, err := elemental.GetTPMHash(k8s, kind, cfg.ClusterNS, hostName)
+					Expect(err).To(Not(HaveOccurred()))
+					Expect(hashes).To(Not(HaveKey(hash)), "%s has the same TPM hash as %s", hostName, hashes[hash])
+					hashes[hash] = hostName
+				}
+			})
+		}
+	})
+})
+
+/*
+Check that the nodes are added in the CAPI cluster(s)
+  - @param ready Function called when the ElementalHost of a node is ready
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func checkCAPIClusters(ready func(string)) {
+	var wg sync.WaitGroup
+
+	By("Checking elemental hosts status", func() {
+		for index := cfg.VMIndex; index <= cfg.VMNumbers; index++ {
+			// Set node hostname
+			hostName := elemental.SetHostname(vmNameRoot, index)
+			Expect(hostName).To(Not(BeEmpty()))
+			GinkgoWriter.Printf("Check elementalhost %s\n", hostName)
+			WaitElementalResources(cfg.ClusterNS, condition.ElementalHost, hostName)
+			ready(hostName)
+		}
+	})
+
+	By("Checking elemental machines status", func() {
+		elementalMachineList, err := kubectl.RunWithoutErr("get", "elementalmachine",
+			"--namespace", cfg.ClusterNS, "-o", "jsonpath={.items[*].metadata.name}")
+		Expect(err).To(Not(HaveOccurred()))
+
+		for _, machine := range strings.Fields(elementalMachineList) {
+			GinkgoWriter.Printf("Check elementalmachine %s\n", machine)
+			WaitElementalResources(cfg.ClusterNS, condition.ElementalMachine, machine)
+		}
+	})
+
+	By("Checking cluster(s) state", func() {
+		for _, c := range cfg.Clusters() {
+			wg.Add(1)
+			go func(cn string) {
+				defer wg.Done()
+				defer GinkgoRecover()
+
+				WaitCAPICluster(cfg.ClusterNS, cn)
+			}(c.Name)
+		}
+		wg.Wait()
+	})
+}
+
+/*
+Check that the nodes are added in the Rancher cluster(s) through their MachineInventories
+  - @param ready Function called when the MachineInventory of a node is ready
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func checkVanillaClusters(ready func(string)) {
+	var wg sync.WaitGroup
+
+	By("Checking machine inventories status", func() {
+		for index := cfg.VMIndex; index <= cfg.VMNumbers; index++ {
+			// MachineInventories are named like the nodes
+			hostName := elemental.SetHostname(vmNameRoot, index)
+			Expect(hostName).To(Not(BeEmpty()))
+			GinkgoWriter.Printf("Check machineinventory %s\n", hostName)
+			WaitElementalResources(cfg.ClusterNS, condition.MachineInventory, hostName)
+			ready(hostName)
+		}
+	})
+
+	By("Selecting the machine inventories of each cluster", func() {
+		for _, c := range cfg.Clusters() {
+			SetMachineInventoryRoles(cfg.ClusterNS, c)
+		}
+	})
+
+	By("Checking cluster(s) state", func() {
+		for _, c := range cfg.Clusters() {
+			wg.Add(1)
+			go func(cn string) {
+				defer wg.Done()
+				defer GinkgoRecover()
+
+				WaitRancherCluster(cfg.ClusterNS, cn)
+			}(c.Name)
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+var _ = Describe("E2E - Configure test", Label("configure"), func() {
+	BeforeEach(func() {
+		if cfg.OperatorType != config.OperatorTypeVanilla {
+			Skip("OPERATOR_TYPE is not " + config.OperatorTypeVanilla)
+		}
+	})
+
+	It("Configure Rancher and the elemental operator", func() {
+		// Set temporary file
+		tmp, err := tools.CreateTemp("vanilla")
+		Expect(err).To(Not(HaveOccurred()))
+		defer os.Remove(tmp)
+
+		// Render a template and apply it
+		apply := func(t *assets.Template, v *assets.Values, labels map[string]string) {
+			out, err := t.Render(v)
+			Expect(err).To(Not(HaveOccurred()))
+
+			for key, value := range labels {
+				out, err = elemental.AddSelectorToTemplate(out, key, value)
+				Expect(err).To(Not(HaveOccurred()))
+			}
+
+			err = os.WriteFile(tmp, out, 0644)
+			Expect(err).To(Not(HaveOccurred()))
+			err = kubectl.Apply(cfg.ClusterNS, tmp)
+			Expect(err).To(Not(HaveOccurred()))
+		}
+
+		for _, c := range cfg.Clusters() {
+			v := &assets.Values{
+				ClusterName:   c.Name,
+				ControlPlanes: c.ControlPlanes,
+				EmulateTPM:    cfg.EmulateTPM,
+				K8sVersion:    cfg.K8sDownstreamVersion,
+				Namespace:     cfg.ClusterNS,
+				Password:      userPassword,
+				User:          userName,
+				Workers:       c.Workers,
+			}
+
+			By("Creating the machine registration of "+c.Name, func() {
+				registration := &assets.Template{
+					File:       registrationYaml,
+					APIVersion: "elemental.cattle.io/v1beta1",
+					Kind:       "MachineRegistration",
+				}
+				if cfg.EmulateTPM {
+					registration.Overlays = append(registration.Overlays, ws.Asset(emulateTPMYaml))
+				}
+				apply(registration, v, nil)
+
+				// Check that the machine registration is correctly created
+				CheckCreatedRegistration(cfg.ClusterNS, "machine-registration-master-"+c.Name)
+			})
+
+			By("Creating the machine inventory selector templates of "+c.Name, func() {
+				for _, role := range []string{"master", "worker"} {
+					v.Role = role
+					apply(&assets.Template{
+						File:       ws.Asset(selectorYaml),
+						APIVersion: "elemental.cattle.io/v1beta1",
+						Kind:       "MachineInventorySelectorTemplate",
+					}, v, map[string]string{
+						// Label set by the machine registration
+						"cluster-name": c.Name,
+						// Label set once the node is registered, see SetMachineInventoryRoles
+						roleLabel: role,
+					})
+				}
+
+				out, err := kubectl.RunWithoutErr("get", "MachineInventorySelectorTemplate",
+					"--namespace", cfg.ClusterNS,
+					"-o", "jsonpath={.items[*].metadata.name}")
+				Expect(err).To(Not(HaveOccurred()))
+				Expect(strings.Fields(out)).To(ContainElements("selector-master-"+c.Name, "selector-worker-"+c.Name))
+			})
+
+			By("Creating the Rancher cluster "+c.Name, func() {
+				apply(&assets.Template{
+					File:       clusterYaml,
+					APIVersion: "provisioning.cattle.io/v1",
+					Kind:       "Cluster",
+				}, v, nil)
+
+				// The cluster stays in provisioning state until nodes are added
+				Eventually(func() error {
+					return k8s.Get(elemental.KindProvisioningCluster, cfg.ClusterNS, c.Name, &elemental.ProvisioningCluster{})
+				}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(Not(HaveOccurred()))
+			})
+		}
+	})
+})
@@ -24,6 +24,8 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/vm"
+	"github.com/rancher/elemental/tests/e2e/helpers/workspace"
 )
 
 var _ = Describe("E2E - Deploy management host with K3S", Label("install-mgmt-host"), func() {
@@ -41,15 +43,17 @@ var _ = Describe("E2E - Deploy management host with K3S", Label("install-mgmt-ho
 		})
 
 		By("Creating the host management VM", func() {
-			err := exec.Command("sudo", "virt-install",
-				"--name", "management-host",
-				"--memory", "16384",
-				"--vcpus", "4",
-				"--disk", "path="+os.Getenv("HOME")+"/rancher-image.qcow2,bus=sata",
-				"--import",
-				"--os-variant", "opensuse-unknown",
-				"--network=default,mac=52:54:00:00:00:10",
-				"--noautoconsole").Run()
+			err := hypervisor.Define(&vm.Options{
+				Name:     "management-host",
+				MAC:      "52:54:00:00:00:10",
+				BootType: vm.BootImport,
+				Disk:     os.Getenv("HOME") + "/rancher-image.qcow2",
+				DiskBus:  "sata",
+				Memory:   16384,
+				CPU:      4,
+			})
+			Expect(err).To(Not(HaveOccurred()))
+			err = hypervisor.Start("management-host")
 			Expect(err).To(Not(HaveOccurred()))
 		})
 	})
@@ -78,7 +82,7 @@ var _ = Describe("E2E - Deploy management host with K3S", Label("install-mgmt-ho
 			CheckSSH(client)
 
 			// Create the destination repository
-			_, err := client.RunSSH("INSTALL_K3S_VERSION=" + k8sUpstreamVersion + " bash -c 'curl -sfL https://get.k3s.io | sh -'")
+			_, err := client.RunSSH("INSTALL_K3S_VERSION=" + cfg.K8sUpstreamVersion + " bash -c 'curl -sfL https://get.k3s.io | sh -'")
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
@@ -103,11 +107,11 @@ var _ = Describe("E2E - Deploy management host with K3S", Label("install-mgmt-ho
 
 		By("Installing kubectl", func() {
 			// TODO: Variable for kubectl version
-			err := exec.Command("curl", "-sLO", "https://dl.k8s.io/release/v1.28.2/bin/linux/amd64/kubectl").Run()
+			err := workspace.Command(ws.Suite, "curl", "-sLO", "https://dl.k8s.io/release/v1.28.2/bin/linux/amd64/kubectl").Run()
 			Expect(err).To(Not(HaveOccurred()))
-			err = exec.Command("chmod", "+x", "kubectl").Run()
+			err = workspace.Command(ws.Suite, "chmod", "+x", "kubectl").Run()
 			Expect(err).To(Not(HaveOccurred()))
-			err = exec.Command("sudo", "mv", "kubectl", "/usr/local/bin/").Run()
+			err = workspace.Command(ws.Suite, "sudo", "mv", "kubectl", "/usr/local/bin/").Run()
 			Expect(err).To(Not(HaveOccurred()))
 		})
 		By("Waiting for K3s to be started", func() {
@@ -0,0 +1,89 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+var _ = Describe("E2E - Checking downstream cluster nodes", Label("check-nodes"), func() {
+	It("Check the nodes of the downstream cluster(s)", func() {
+		for _, c := range cfg.Clusters() {
+			nodes := &elemental.NodeList{}
+
+			// Downstream cluster is accessed through the kubeconfig generated by CAPI
+			downstream := elemental.NewDynamic(GetDownstreamKubeconfig(cfg.ClusterNS, c.Name))
+
+			By("Checking the number of nodes in "+c.Name, func() {
+				err := downstream.List(elemental.KindNode, "", "", nodes)
+				Expect(err).To(Not(HaveOccurred()))
+				Expect(nodes.Items).To(HaveLen(c.Machines()))
+			})
+
+			By("Checking that all the nodes of "+c.Name+" are Ready", func() {
+				for _, n := range nodes.Items {
+					ready := ""
+					for _, cond := range n.Status.Conditions {
+						if cond.Type == "Ready" {
+							ready = cond.Status
+						}
+					}
+					Expect(ready).To(Equal("True"), "node %s is not ready", n.Metadata.Name)
+				}
+			})
+
+			By("Checking the node names of "+c.Name, func() {
+				hostNames := []string{}
+				for index := c.VMIndex; index <= c.VMNumbers; index++ {
+					hostNames = append(hostNames, elemental.SetHostname(vmNameRoot, index))
+				}
+
+				names := []string{}
+				for _, n := range nodes.Items {
+					names = append(names, n.Metadata.Name)
+				}
+				Expect(hostNames).To(ContainElements(names))
+			})
+
+			By("Checking the providerID of the nodes of "+c.Name, func() {
+				machines := &elemental.MachineList{}
+				err := k8s.List(elemental.KindMachine, cfg.ClusterNS, "cluster.x-k8s.io/cluster-name="+c.Name, machines)
+				Expect(err).To(Not(HaveOccurred()))
+
+				// ProviderID of the ElementalMachine linked to each node
+				providerIDs := map[string]string{}
+				for _, m := range machines.Items {
+					if m.Status.NodeRef == nil {
+						continue
+					}
+
+					em := &elemental.ElementalMachine{}
+					err := k8s.Get(elemental.KindElementalMachine, cfg.ClusterNS, m.Spec.InfrastructureRef.Name, em)
+					Expect(err).To(Not(HaveOccurred()))
+					providerIDs[m.Status.NodeRef.Name] = em.Spec.ProviderID
+				}
+
+				for _, n := range nodes.Items {
+					Expect(providerIDs).To(HaveKey(n.Metadata.Name), "node %s has no machine", n.Metadata.Name)
+					Expect(n.Spec.ProviderID).To(Not(BeEmpty()))
+					Expect(n.Spec.ProviderID).To(Equal(providerIDs[n.Metadata.Name]),
+						"providerID of node %s does not match its ElementalMachine", n.Metadata.Name)
+				}
+			})
+		}
+	})
+})
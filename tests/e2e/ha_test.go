@@ -0,0 +1,146 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+const (
+	// Run on the node, RKE2 embeds kubectl and etcdctl is available in the etcd pod
+	rke2Kubectl     = "/var/lib/rancher/rke2/bin/kubectl --kubeconfig /etc/rancher/rke2/rke2.yaml"
+	etcdCerts       = "--cacert /var/lib/rancher/rke2/server/tls/etcd/server-ca.crt --cert /var/lib/rancher/rke2/server/tls/etcd/server-client.crt --key /var/lib/rancher/rke2/server/tls/etcd/server-client.key"
+	apiServerHealth = "curl -sk https://127.0.0.1:6443/readyz"
+)
+
+var _ = Describe("E2E - Checking HA control plane", Label("ha"), func() {
+	// Get the sorted control plane nodes of a cluster
+	controlPlaneNodes := func(cn string) []string {
+		var nodes []string
+		Eventually(func() error {
+			var err error
+			nodes, err = elemental.GetControlPlaneNodes(k8s, cfg.ClusterNS, cn)
+			return err
+		}, tools.SetTimeout(2*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+
+		return nodes
+	}
+
+	// Get the Ready status of a downstream node
+	nodeReady := func(kubeconfig, node string) string {
+		n := &elemental.Node{}
+		downstream := elemental.NewDynamic(kubeconfig)
+		if err := downstream.Get(elemental.KindNode, "", node, n); err != nil {
+			GinkgoWriter.Printf("!! Cannot get node %s !! %s\n", node, err)
+			return ""
+		}
+
+		for _, cond := range n.Status.Conditions {
+			if cond.Type == "Ready" {
+				return cond.Status
+			}
+		}
+		return ""
+	}
+
+	BeforeEach(func() {
+		if !cfg.HA() {
+			Skip("CONTROL_PLANE_COUNT should be at least 3 for HA control plane")
+		}
+		if cfg.BootstrapProvider != "rke2" {
+			Skip("HA checks are only available with rke2 bootstrap provider")
+		}
+	})
+
+	It("Check etcd and kube-apiserver on each control plane node", func() {
+		for _, c := range cfg.Clusters() {
+			nodes := controlPlaneNodes(c.Name)
+			Expect(nodes).To(HaveLen(c.ControlPlanes))
+
+			for _, h := range nodes {
+				client, _ := GetNodeInfo(h)
+				Expect(client).To(Not(BeNil()))
+
+				By("Checking kube-apiserver on "+h, func() {
+					out := RunSSHWithRetry(client, apiServerHealth)
+					Expect(strings.TrimSpace(out)).To(Equal("ok"))
+				})
+
+				By("Checking etcd members seen from "+h, func() {
+					out := RunSSHWithRetry(client, rke2Kubectl+" --namespace kube-system exec etcd-"+h+" -- etcdctl "+etcdCerts+" member list")
+					Expect(strings.Count(out, "started")).To(Equal(c.ControlPlanes))
+
+					// Members are named after the nodes
+					for _, n := range nodes {
+						Expect(out).To(ContainSubstring(n+"-"), "%s is not an etcd member", n)
+					}
+				})
+			}
+		}
+	})
+
+	It("Keep the cluster available when a control plane node fails", func() {
+		c := cfg.Clusters()[0]
+		nodes := controlPlaneNodes(c.Name)
+
+		// Kubeconfig uses the first control plane node, so destroy the last one
+		kubeconfig := GetDownstreamKubeconfig(cfg.ClusterNS, c.Name)
+		failed := nodes[len(nodes)-1]
+
+		By("Destroying control plane node "+failed, func() {
+			err := hypervisor.Destroy(failed)
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		By("Checking that the cluster is still available", func() {
+			Eventually(func() string {
+				return nodeReady(kubeconfig, failed)
+			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(Not(Equal("True")))
+
+			// etcd should still have the quorum, so writes must work
+			_, err := kubectl.RunWithoutErr("--kubeconfig", kubeconfig, "--namespace", "default",
+				"create", "configmap", "ha-check", "--from-literal=failed="+failed)
+			Expect(err).To(Not(HaveOccurred()))
+			_, err = kubectl.RunWithoutErr("--kubeconfig", kubeconfig, "--namespace", "default",
+				"delete", "configmap", "ha-check")
+			Expect(err).To(Not(HaveOccurred()))
+
+			for _, h := range nodes[:len(nodes)-1] {
+				client, _ := GetNodeInfo(h)
+				Expect(client).To(Not(BeNil()))
+				out := RunSSHWithRetry(client, apiServerHealth)
+				Expect(strings.TrimSpace(out)).To(Equal("ok"))
+			}
+		})
+
+		By("Restarting control plane node "+failed, func() {
+			err := hypervisor.Start(failed)
+			Expect(err).To(Not(HaveOccurred()))
+
+			Eventually(func() string {
+				return nodeReady(kubeconfig, failed)
+			}, tools.SetTimeout(10*time.Minute), 20*time.Second).Should(Equal("True"))
+
+			WaitCAPICluster(cfg.ClusterNS, c.Name)
+		})
+	})
+})
@@ -0,0 +1,255 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotAdmitted is returned when a node cannot be admitted before the end of the context
+var ErrNotAdmitted = errors.New("node not admitted")
+
+// HostLoad is the load of the host, as read in /proc
+type HostLoad struct {
+	// Load average of the last minute
+	Load1 float64
+	// Number of CPUs
+	CPUs int
+	// Available memory in MB
+	MemAvailable int
+}
+
+// String returns a human readable host load
+func (l *HostLoad) String() string {
+	return fmt.Sprintf("load %.2f for %d CPUs, %dMB available", l.Load1, l.CPUs, l.MemAvailable)
+}
+
+/*
+Read the host load
+  - @param procDir Directory where proc filesystem is mounted, usually /proc
+  - @returns The host load or an error
+*/
+func ReadHostLoad(procDir string) (*HostLoad, error) {
+	l := &HostLoad{}
+
+	data, err := os.ReadFile(filepath.Join(procDir, "loadavg"))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty %s", filepath.Join(procDir, "loadavg"))
+	}
+	if l.Load1, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return nil, err
+	}
+
+	// Each CPU has its own cpuN line, cpu line being the total
+	err = scanFile(filepath.Join(procDir, "stat"), func(fields []string) error {
+		if strings.HasPrefix(fields[0], "cpu") && fields[0] != "cpu" {
+			l.CPUs++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanFile(filepath.Join(procDir, "meminfo"), func(fields []string) error {
+		if fields[0] != "MemAvailable:" || len(fields) < 2 {
+			return nil
+		}
+		kb, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return err
+		}
+		l.MemAvailable = kb / 1024
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+/*
+Call a function for each non empty line of a file
+  - @param file File to read
+  - @param f Function called with the fields of the line
+  - @returns Nothing or an error
+*/
+func scanFile(file string, f func(fields []string) error) error {
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	s := bufio.NewScanner(fd)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := f(fields); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	return s.Err()
+}
+
+// Controller admits new node installations while the host can handle them
+type Controller struct {
+	// Maximum number of nodes being installed at the same time
+	MaxInFlight int
+	// Maximum load average in percent of the CPUs, 0 to disable the check
+	MaxLoad int
+	// Minimum available memory in MB, 0 to disable the check
+	MinMemory int
+	// Interval between two checks of the host load
+	Interval time.Duration
+	// Minimum time between two admissions when the host load is checked, as the load average lags
+	MinInterval time.Duration
+	// Directory where proc filesystem is mounted
+	ProcDir string
+
+	once  sync.Once
+	slots chan struct{}
+	// Held while a node is being admitted, so the load is checked for one node at a time
+	admitting chan struct{}
+	last      time.Time
+}
+
+/*
+Create an admission controller without host load check
+  - @param maxInFlight Maximum number of nodes being installed at the same time
+  - @returns Pointer to the Controller structure
+*/
+func New(maxInFlight int) *Controller {
+	return &Controller{
+		MaxInFlight: maxInFlight,
+		Interval:    10 * time.Second,
+		MinInterval: 30 * time.Second,
+		ProcDir:     "/proc",
+	}
+}
+
+// init creates the slots on first use, so the fields can be set after New
+func (c *Controller) init() {
+	c.once.Do(func() {
+		c.slots = make(chan struct{}, max(c.MaxInFlight, 1))
+		c.admitting = make(chan struct{}, 1)
+	})
+}
+
+/*
+Wait for a free slot and for the host to be able to handle a new node
+  - @param ctx Context to cancel the wait
+  - @returns Nothing or an error if the node has not been admitted, the slot must be released otherwise
+*/
+func (c *Controller) Acquire(ctx context.Context) error {
+	c.init()
+
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %d nodes in flight", ErrNotAdmitted, len(c.slots))
+	}
+
+	if c.MaxLoad <= 0 && c.MinMemory <= 0 {
+		return nil
+	}
+
+	// Nodes admitted just before have not impacted the load average yet
+	select {
+	case c.admitting <- struct{}{}:
+	case <-ctx.Done():
+		c.Release()
+		return fmt.Errorf("%w: %d nodes in flight", ErrNotAdmitted, len(c.slots))
+	}
+	defer func() { <-c.admitting }()
+
+	if wait := time.Until(c.last.Add(c.MinInterval)); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			c.Release()
+			return fmt.Errorf("%w: last node admitted less than %s ago", ErrNotAdmitted, c.MinInterval)
+		}
+	}
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		l, err := ReadHostLoad(c.ProcDir)
+		if err != nil {
+			c.Release()
+			return err
+		}
+		if c.loadOK(l) {
+			c.last = time.Now()
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			c.Release()
+			return fmt.Errorf("%w: host %s", ErrNotAdmitted, l)
+		}
+	}
+}
+
+// loadOK checks the host load against the thresholds
+func (c *Controller) loadOK(l *HostLoad) bool {
+	if c.MaxLoad > 0 && l.Load1*100 > float64(c.MaxLoad*max(l.CPUs, 1)) {
+		return false
+	}
+	if c.MinMemory > 0 && l.MemAvailable < c.MinMemory {
+		return false
+	}
+
+	return true
+}
+
+// Release frees the slot of a node, once its installation is done, it panics if no slot is used
+func (c *Controller) Release() {
+	c.init()
+
+	select {
+	case <-c.slots:
+	default:
+		panic("admission: Release called without a matching Acquire")
+	}
+}
+
+// InFlight returns the number of nodes currently admitted
+func (c *Controller) InFlight() int {
+	c.init()
+
+	return len(c.slots)
+}
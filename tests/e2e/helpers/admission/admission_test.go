@@ -0,0 +1,136 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/admission"
+)
+
+const (
+	stat    = "cpu  10 0 10 100\ncpu0 5 0 5 50\ncpu1 5 0 5 50\nintr 1234\n"
+	meminfo = "MemTotal:       16384000 kB\nMemFree:         1024000 kB\nMemAvailable:    8192000 kB\n"
+)
+
+// writeProc writes a fake proc directory with the given load average
+func writeProc(dir, loadavg string) {
+	for f, content := range map[string]string{"loadavg": loadavg, "stat": stat, "meminfo": meminfo} {
+		Expect(os.WriteFile(filepath.Join(dir, f), []byte(content), 0644)).To(Succeed())
+	}
+}
+
+// timeout returns a context cancelled after a short time
+func timeout() context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	DeferCleanup(cancel)
+
+	return ctx
+}
+
+var _ = Describe("Admission controller", func() {
+	var procDir string
+
+	BeforeEach(func() {
+		procDir = GinkgoT().TempDir()
+		writeProc(procDir, "0.50 0.40 0.30 1/200 4242\n")
+	})
+
+	It("reads the host load", func() {
+		l, err := admission.ReadHostLoad(procDir)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(*l).To(Equal(admission.HostLoad{Load1: 0.5, CPUs: 2, MemAvailable: 8000}))
+
+		_, err = admission.ReadHostLoad(filepath.Join(procDir, "missing"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("limits the number of nodes in flight", func() {
+		c := admission.New(2)
+		Expect(c.Acquire(timeout())).To(Succeed())
+		Expect(c.Acquire(timeout())).To(Succeed())
+		Expect(c.InFlight()).To(Equal(2))
+
+		Expect(c.Acquire(timeout())).To(MatchError(admission.ErrNotAdmitted))
+
+		c.Release()
+		Expect(c.Acquire(timeout())).To(Succeed())
+
+		// Releasing more than acquired is a bug in the caller
+		c.Release()
+		c.Release()
+		Expect(c.InFlight()).To(BeZero())
+		Expect(c.Release).To(PanicWith(ContainSubstring("without a matching Acquire")))
+	})
+
+	It("waits between two admissions when the host load is checked", func() {
+		c := admission.New(10)
+		c.ProcDir = procDir
+		c.Interval = 10 * time.Millisecond
+		c.MinInterval = 200 * time.Millisecond
+		c.MaxLoad = 80
+
+		Expect(c.Acquire(timeout())).To(Succeed())
+
+		// The load average is still low, but the first node may not have impacted it yet
+		Expect(c.Acquire(timeout())).To(MatchError(ContainSubstring("last node admitted less than")))
+		Expect(c.InFlight()).To(Equal(1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		start := time.Now()
+		Expect(c.Acquire(ctx)).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">", 50*time.Millisecond))
+		Expect(c.InFlight()).To(Equal(2))
+	})
+
+	It("waits for the host load to decrease", func() {
+		c := admission.New(10)
+		c.ProcDir = procDir
+		c.Interval = 10 * time.Millisecond
+		c.MaxLoad = 80
+
+		writeProc(procDir, "2.00 1.50 1.00 1/200 4242\n")
+		Expect(c.Acquire(timeout())).To(MatchError(admission.ErrNotAdmitted))
+		Expect(c.InFlight()).To(BeZero())
+
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(30 * time.Millisecond)
+			writeProc(procDir, "1.20 1.50 1.00 1/200 4242\n")
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		Expect(c.Acquire(ctx)).To(Succeed())
+		Expect(c.InFlight()).To(Equal(1))
+	})
+
+	It("checks the available memory", func() {
+		c := admission.New(10)
+		c.ProcDir = procDir
+		c.Interval = 10 * time.Millisecond
+
+		c.MinMemory = 16000
+		Expect(c.Acquire(timeout())).To(MatchError(ContainSubstring("8000MB available")))
+
+		c.MinMemory = 4096
+		Expect(c.Acquire(timeout())).To(Succeed())
+	})
+})
@@ -0,0 +1,341 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrUnknownPlaceholder is returned when a template contains a placeholder not defined in Values
+	ErrUnknownPlaceholder = errors.New("unknown placeholder")
+
+	// ErrUnresolvedPlaceholder is returned when a placeholder used by a template has no value
+	ErrUnresolvedPlaceholder = errors.New("unresolved placeholder")
+
+	// ErrUnexpectedKind is returned when the rendered YAML is not of the expected apiVersion/kind
+	ErrUnexpectedKind = errors.New("unexpected apiVersion/kind")
+)
+
+// Placeholders are written %NAME% in the templates
+var placeholderRegexp = regexp.MustCompile(`%([A-Z][A-Z0-9_]*)%`)
+
+// Values used to render the templates, the tag gives the placeholder name
+type Values struct {
+	AdminUser            string `placeholder:"ADMIN_USER"`
+	ClusterName          string `placeholder:"CLUSTER_NAME"`
+	ControlPlanes        int    `placeholder:"CONTROL_PLANE_COUNT"`
+	ElementalAPIEndpoint string `placeholder:"ELEMENTAL_API_ENDPOINT"`
+	EmulateTPM           bool   `placeholder:"EMULATE_TPM"`
+	K8sVersion           string `placeholder:"K8S_VERSION"`
+	Namespace            string `placeholder:"NAMESPACE"`
+	OSVersion            string `placeholder:"OS_VERSION"`
+	Password             string `placeholder:"PASSWORD"`
+	Role                 string `placeholder:"ROLE"`
+	User                 string `placeholder:"USER"`
+	Workers              int    `placeholder:"WORKER_COUNT"`
+}
+
+/*
+Get the values indexed by placeholder name
+  - @returns The set values (empty strings are not set) and the kind of all the known placeholders
+*/
+func (v *Values) placeholders() (set map[string]string, known map[string]reflect.Kind) {
+	set = make(map[string]string)
+	known = make(map[string]reflect.Kind)
+
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name := rt.Field(i).Tag.Get("placeholder")
+		if name == "" {
+			continue
+		}
+
+		f := rv.Field(i)
+		known[name] = f.Kind()
+		switch f.Kind() {
+		case reflect.String:
+			if f.String() != "" {
+				set[name] = f.String()
+			}
+		case reflect.Bool:
+			// A boolean is always set
+			set[name] = strconv.FormatBool(f.Bool())
+		case reflect.Int, reflect.Int64:
+			set[name] = strconv.FormatInt(f.Int(), 10)
+		}
+	}
+
+	return set, known
+}
+
+/*
+Replace the placeholders of a YAML template
+  - @param name Name of the template, used in errors
+  - @param content Content of the template
+  - @param v Values to use
+  - @returns The rendered content or an error listing all the placeholders in error
+*/
+func RenderString(name, content string, v *Values) (string, error) {
+	set, known := v.placeholders()
+
+	// Placeholders are first replaced by tokens that can be parsed as YAML
+	var errs []error
+	seen := make(map[string]bool)
+	tokenized := placeholderRegexp.ReplaceAllStringFunc(content, func(p string) string {
+		key := strings.Trim(p, "%")
+		if _, ok := set[key]; !ok && !seen[key] {
+			seen[key] = true
+			if _, ok := known[key]; ok {
+				errs = append(errs, fmt.Errorf("%w %s in %s", ErrUnresolvedPlaceholder, p, name))
+			} else {
+				errs = append(errs, fmt.Errorf("%w %s in %s", ErrUnknownPlaceholder, p, name))
+			}
+		}
+
+		return "~~" + key + "~~"
+	})
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	// Then the values are set in the parsed documents, the encoder quotes them if needed
+	var out bytes.Buffer
+	e := yaml.NewEncoder(&out)
+	e.SetIndent(2)
+	d := yaml.NewDecoder(strings.NewReader(tokenized))
+	for {
+		doc := &yaml.Node{}
+		err := d.Decode(doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid YAML template %s: %w", name, err)
+		}
+
+		setValues(doc, set, known)
+		if err := e.Encode(doc); err != nil {
+			return "", err
+		}
+	}
+	if err := e.Close(); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// Placeholders are replaced by ~~NAME~~ tokens before parsing the templates
+var tokenRegexp = regexp.MustCompile(`~~([A-Z][A-Z0-9_]*)~~`)
+
+/*
+Replace the tokens in the scalars and the comments of a YAML node, recursively
+  - @param n YAML node
+  - @param set Values indexed by placeholder name
+  - @param known Kind of the placeholders
+  - @returns Nothing, the node is updated in place
+*/
+func setValues(n *yaml.Node, set map[string]string, known map[string]reflect.Kind) {
+	replace := func(s string) string {
+		return tokenRegexp.ReplaceAllStringFunc(s, func(t string) string {
+			return set[strings.Trim(t, "~")]
+		})
+	}
+
+	n.HeadComment = replace(n.HeadComment)
+	n.LineComment = replace(n.LineComment)
+	n.FootComment = replace(n.FootComment)
+
+	if n.Kind == yaml.ScalarNode && tokenRegexp.MatchString(n.Value) {
+		// A lone placeholder keeps the type of its value, anything else is a string
+		m := tokenRegexp.FindStringSubmatch(n.Value)
+		if m[0] == n.Value && n.Style == 0 && known[m[1]] != reflect.String {
+			n.Tag = ""
+		} else {
+			n.Tag = "!!str"
+		}
+		n.Value = replace(n.Value)
+
+		// Plain scalars are quoted by the encoder when needed
+		if n.Style != yaml.DoubleQuotedStyle && n.Style != yaml.SingleQuotedStyle {
+			n.Style = 0
+		}
+	}
+
+	for _, c := range n.Content {
+		setValues(c, set, known)
+	}
+}
+
+/*
+Check that YAML documents can be parsed and that the first one has the expected type
+  - @param data YAML documents
+  - @param apiVersion Expected apiVersion, not checked if empty
+  - @param kind Expected kind, not checked if empty
+  - @returns Nothing or an error
+*/
+func Validate(data []byte, apiVersion, kind string) error {
+	type typeMeta struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+	}
+
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 0; ; i++ {
+		t := typeMeta{}
+		err := d.Decode(&t)
+		if err == io.EOF {
+			if i == 0 {
+				return errors.New("no YAML document found")
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid YAML document #%d: %w", i+1, err)
+		}
+
+		if i > 0 {
+			continue
+		}
+		if (apiVersion != "" && t.APIVersion != apiVersion) || (kind != "" && t.Kind != kind) {
+			return fmt.Errorf("%w: %s/%s instead of %s/%s", ErrUnexpectedKind, t.APIVersion, t.Kind, apiVersion, kind)
+		}
+	}
+}
+
+/*
+Deep merge a YAML overlay into a YAML document, maps are merged and other values are replaced
+  - @param base YAML document
+  - @param overlay YAML document to merge into base
+  - @returns The merged YAML document or an error
+*/
+func Merge(base, overlay []byte) ([]byte, error) {
+	var b, o map[string]interface{}
+
+	if err := yaml.Unmarshal(base, &b); err != nil {
+		return nil, fmt.Errorf("invalid base document: %w", err)
+	}
+	if err := yaml.Unmarshal(overlay, &o); err != nil {
+		return nil, fmt.Errorf("invalid overlay document: %w", err)
+	}
+
+	return yaml.Marshal(mergeMaps(b, o))
+}
+
+// mergeMaps merges o into b recursively
+func mergeMaps(b, o map[string]interface{}) map[string]interface{} {
+	if b == nil {
+		b = make(map[string]interface{})
+	}
+
+	for k, ov := range o {
+		om, oIsMap := ov.(map[string]interface{})
+		bm, bIsMap := b[k].(map[string]interface{})
+		if oIsMap && bIsMap {
+			b[k] = mergeMaps(bm, om)
+			continue
+		}
+		b[k] = ov
+	}
+
+	return b
+}
+
+// Template is a YAML asset to render
+type Template struct {
+	// Template file
+	File string
+	// Expected apiVersion and kind of the rendered document
+	APIVersion string
+	Kind       string
+	// Templates merged into the rendered document, in order
+	Overlays []string
+}
+
+/*
+Render a template and its overlays
+  - @param v Values to use
+  - @returns The validated YAML document or an error
+*/
+func (t *Template) Render(v *Values) ([]byte, error) {
+	out, err := renderFile(t.File, v)
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(out, t.APIVersion, t.Kind); err != nil {
+		return nil, fmt.Errorf("%s: %w", t.File, err)
+	}
+
+	for _, overlay := range t.Overlays {
+		o, err := renderFile(overlay, v)
+		if err != nil {
+			return nil, err
+		}
+		if out, err = Merge(out, o); err != nil {
+			return nil, fmt.Errorf("%s: %w", overlay, err)
+		}
+	}
+
+	// Overlays must not change the type of the document
+	if len(t.Overlays) > 0 {
+		if err := Validate(out, t.APIVersion, t.Kind); err != nil {
+			return nil, fmt.Errorf("%s with overlays %s: %w", t.File, strings.Join(t.Overlays, ", "), err)
+		}
+	}
+
+	return out, nil
+}
+
+/*
+Render a template into a file
+  - @param v Values to use
+  - @param file File to write
+  - @returns Nothing or an error
+*/
+func (t *Template) RenderFile(v *Values, file string) error {
+	out, err := t.Render(v)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, out, 0644)
+}
+
+// renderFile reads and renders a template file
+func renderFile(file string, v *Values) ([]byte, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := RenderString(file, string(content), v)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(out), nil
+}
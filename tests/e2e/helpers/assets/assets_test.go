@@ -0,0 +1,248 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+	"gopkg.in/yaml.v3"
+)
+
+const assetsDir = "../../../assets"
+
+// registration is the part of the ElementalRegistration checked in the tests
+type registration struct {
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Config struct {
+			CloudConfig struct {
+				Users []struct {
+					Name   string `yaml:"name"`
+					Passwd string `yaml:"passwd"`
+				} `yaml:"users"`
+			} `yaml:"cloudConfig"`
+			Elemental struct {
+				Registration map[string]interface{} `yaml:"registration"`
+				Reset        map[string]interface{} `yaml:"reset"`
+			} `yaml:"elemental"`
+		} `yaml:"config"`
+	} `yaml:"spec"`
+}
+
+func values() *assets.Values {
+	return &assets.Values{
+		ClusterName:          "cluster-k3s",
+		ElementalAPIEndpoint: "192.168.122.102.sslip.io",
+		Namespace:            "fleet-default",
+		Password:             `r0s@pwd1$&\1`,
+		User:                 "root",
+	}
+}
+
+func write(content string) string {
+	file := filepath.Join(GinkgoT().TempDir(), "template.yaml")
+	Expect(os.WriteFile(file, []byte(content), 0644)).To(Succeed())
+
+	return file
+}
+
+var _ = Describe("Assets rendering", func() {
+	registrationTemplate := func() *assets.Template {
+		return &assets.Template{
+			File:       filepath.Join(assetsDir, "capi_elementalRegistration.yaml"),
+			APIVersion: "infrastructure.cluster.x-k8s.io/v1beta1",
+			Kind:       "ElementalRegistration",
+		}
+	}
+
+	It("renders the registration with values containing special characters", func() {
+		out, err := registrationTemplate().Render(values())
+		Expect(err).To(Not(HaveOccurred()))
+
+		r := registration{}
+		Expect(yaml.Unmarshal(out, &r)).To(Succeed())
+		Expect(r.Metadata.Name).To(Equal("machine-registration-master-cluster-k3s"))
+		Expect(r.Spec.Config.CloudConfig.Users[0].Passwd).To(Equal(`r0s@pwd1$&\1`))
+		Expect(r.Spec.Config.Elemental.Registration).To(HaveKeyWithValue("uri",
+			"https://192.168.122.102.sslip.io:30009/elemental/v1/namespaces/fleet-default/registrations/machine-registration-master-cluster-k3s"))
+	})
+
+	DescribeTable("renders values that are not valid plain YAML scalars",
+		func(password string) {
+			v := values()
+			v.Password = password
+			v.User = password
+
+			out, err := registrationTemplate().Render(v)
+			Expect(err).To(Not(HaveOccurred()))
+
+			r := registration{}
+			Expect(yaml.Unmarshal(out, &r)).To(Succeed())
+			Expect(r.Spec.Config.CloudConfig.Users[0].Name).To(Equal(password))
+			Expect(r.Spec.Config.CloudConfig.Users[0].Passwd).To(Equal(password))
+		},
+		Entry("with a colon", "pass: word"),
+		Entry("with a comment", "pass #word"),
+		Entry("with double quotes", `"password"`),
+		Entry("with single quotes", "pass'word'"),
+		Entry("with an alias", "*password"),
+		Entry("with an anchor", "&password"),
+		Entry("with a reserved indicator", "@password"),
+		Entry("with a flow sequence", "[password]"),
+		Entry("with a boolean", "true"),
+		Entry("with a number", "0123"),
+	)
+
+	It("keeps the type of the values and quotes embedded ones", func() {
+		v := values()
+		v.ClusterName = "a: b"
+		v.Workers = 2
+		v.EmulateTPM = true
+
+		out, err := assets.RenderString("template",
+			"# cluster %CLUSTER_NAME%\nname: pool-%CLUSTER_NAME%\nquoted: \"%CLUSTER_NAME%\"\nquantity: %WORKER_COUNT%\ntpm: %EMULATE_TPM%\ncount: '%WORKER_COUNT%'\n", v)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(out).To(ContainSubstring("# cluster a: b"))
+
+		m := map[string]interface{}{}
+		Expect(yaml.Unmarshal([]byte(out), &m)).To(Succeed())
+		Expect(m).To(Equal(map[string]interface{}{
+			"name":     "pool-a: b",
+			"quoted":   "a: b",
+			"quantity": 2,
+			"tpm":      true,
+			"count":    "2",
+		}))
+	})
+
+	It("fails on unresolved placeholders", func() {
+		v := values()
+		v.ClusterName = ""
+
+		_, err := registrationTemplate().Render(v)
+		Expect(err).To(MatchError(assets.ErrUnresolvedPlaceholder))
+		Expect(err).To(MatchError(ContainSubstring("%CLUSTER_NAME%")))
+	})
+
+	It("fails on unknown placeholders", func() {
+		file := write("apiVersion: v1\nkind: ConfigMap\ndata:\n  a: %FOO%\n  b: %BAR%\n  c: 25%\n")
+
+		_, err := (&assets.Template{File: file}).Render(values())
+		Expect(err).To(MatchError(assets.ErrUnknownPlaceholder))
+		Expect(err).To(MatchError(ContainSubstring("%FOO%")))
+		Expect(err).To(MatchError(ContainSubstring("%BAR%")))
+	})
+
+	It("validates the type of the document", func() {
+		t := registrationTemplate()
+		t.Kind = "MachineRegistration"
+
+		_, err := t.Render(values())
+		Expect(err).To(MatchError(assets.ErrUnexpectedKind))
+
+		Expect(assets.Validate([]byte("a: [b"), "", "")).To(MatchError(ContainSubstring("invalid YAML")))
+		Expect(assets.Validate([]byte(""), "", "")).To(Not(Succeed()))
+	})
+
+	It("renders the other assets", func() {
+		v := values()
+		v.OSVersion = "v2.1.0"
+
+		out, err := (&assets.Template{
+			File:       filepath.Join(assetsDir, "upgrade_managedOSImage.yaml"),
+			APIVersion: "elemental.cattle.io/v1beta1",
+			Kind:       "ManagedOSImage",
+		}).Render(v)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(out)).To(ContainSubstring("managedOSVersionName: v2.1.0"))
+
+		// Documents without placeholder are valid templates too
+		_, err = (&assets.Template{
+			File:       filepath.Join(assetsDir, "hello-world_app.yaml"),
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+		}).Render(v)
+		Expect(err).To(Not(HaveOccurred()))
+	})
+
+	It("renders the vanilla operator assets", func() {
+		v := values()
+		v.ControlPlanes = 3
+		v.K8sVersion = "v1.28.9+rke2r1"
+		v.Role = "master"
+
+		out, err := (&assets.Template{
+			File:       filepath.Join(assetsDir, "machineRegistration.yaml"),
+			APIVersion: "elemental.cattle.io/v1beta1",
+			Kind:       "MachineRegistration",
+			Overlays:   []string{filepath.Join(assetsDir, "emulateTPM.yaml")},
+		}).Render(v)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(out)).To(ContainSubstring("machineName: ${System Data/Runtime/Hostname}"))
+		Expect(string(out)).To(ContainSubstring("cluster-name: cluster-k3s"))
+		Expect(string(out)).To(ContainSubstring("emulate-tpm: false"))
+
+		out, err = (&assets.Template{
+			File:       filepath.Join(assetsDir, "selector.yaml"),
+			APIVersion: "elemental.cattle.io/v1beta1",
+			Kind:       "MachineInventorySelectorTemplate",
+		}).Render(v)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(out)).To(ContainSubstring("name: selector-master-cluster-k3s"))
+
+		// No worker is a valid value
+		out, err = (&assets.Template{
+			File:       filepath.Join(assetsDir, "cluster.yaml"),
+			APIVersion: "provisioning.cattle.io/v1",
+			Kind:       "Cluster",
+		}).Render(v)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(out)).To(ContainSubstring("kubernetesVersion: v1.28.9+rke2r1"))
+		Expect(string(out)).To(ContainSubstring("quantity: 3"))
+		Expect(string(out)).To(ContainSubstring("quantity: 0"))
+	})
+
+	It("merges overlays into the registration", func() {
+		v := values()
+		v.EmulateTPM = true
+
+		t := registrationTemplate()
+		t.Overlays = []string{filepath.Join(assetsDir, "emulateTPM.yaml")}
+		out, err := t.Render(v)
+		Expect(err).To(Not(HaveOccurred()))
+
+		r := registration{}
+		Expect(yaml.Unmarshal(out, &r)).To(Succeed())
+		Expect(r.Spec.Config.Elemental.Registration).To(HaveKeyWithValue("emulate-tpm", true))
+		Expect(r.Spec.Config.Elemental.Registration).To(HaveKey("emulated-tpm-seed"))
+
+		// Existing values are kept
+		Expect(r.Spec.Config.Elemental.Registration).To(HaveKey("uri"))
+		Expect(r.Spec.Config.Elemental.Reset).To(HaveKeyWithValue("resetOem", true))
+		Expect(r.Spec.Config.CloudConfig.Users).To(HaveLen(1))
+	})
+
+	It("replaces non map values when merging", func() {
+		out, err := assets.Merge([]byte("a:\n  b: [1, 2]\n  c: x\n"), []byte("a:\n  b: [3]\n  d: y\n"))
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(out)).To(MatchYAML("a:\n  b: [3]\n  c: x\n  d: y\n"))
+	})
+})
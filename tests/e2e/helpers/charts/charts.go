@@ -0,0 +1,98 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package charts
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrNotFound is returned when no archive of the chart is available locally
+	ErrNotFound = errors.New("chart archive not found")
+
+	// ErrAmbiguous is returned when several archives match a chart without version
+	ErrAmbiguous = errors.New("several chart archives found")
+)
+
+// Chart is a Helm chart installed from a local archive
+type Chart struct {
+	// Name of the chart, also the prefix of its archive
+	Name string
+	// Repository used to pull the archive, either an URL or an oci:// reference
+	Repo string
+	// Version of the chart, any version available locally if empty
+	Version string
+}
+
+/*
+Find the local archive of a chart
+  - @param dir Directory containing the archives
+  - @returns Path of the archive or an error
+*/
+func (c Chart) Find(dir string) (string, error) {
+	pattern := c.Name + "-*.tgz"
+	if c.Version != "" {
+		pattern = c.Name + "-" + c.Version + ".tgz"
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return "", err
+	}
+
+	// Other charts can share the same prefix (e.g. rancher and rancher-backup),
+	// so only keep the archives where a version follows the name
+	archives := []string{}
+	for _, f := range files {
+		v := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(f), ".tgz"), c.Name+"-")
+		v = strings.TrimPrefix(v, "v")
+		if v != "" && unicode.IsDigit(rune(v[0])) {
+			archives = append(archives, f)
+		}
+	}
+
+	switch len(archives) {
+	case 0:
+		return "", fmt.Errorf("%w: %s in %s", ErrNotFound, pattern, dir)
+	case 1:
+		return archives[0], nil
+	default:
+		return "", fmt.Errorf("%w: %s, set the version of %s", ErrAmbiguous, strings.Join(archives, ", "), c.Name)
+	}
+}
+
+/*
+Get the Helm arguments to pull the archive of a chart
+  - @param dir Directory where the archive is written
+  - @returns The arguments to give to helm
+*/
+func (c Chart) PullArgs(dir string) []string {
+	args := []string{"pull"}
+	if strings.HasPrefix(c.Repo, "oci://") {
+		args = append(args, strings.TrimSuffix(c.Repo, "/")+"/"+c.Name)
+	} else {
+		args = append(args, c.Name, "--repo", c.Repo)
+	}
+
+	if c.Version != "" {
+		args = append(args, "--version", c.Version)
+	}
+
+	return append(args, "--destination", dir)
+}
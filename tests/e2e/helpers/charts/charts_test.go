@@ -0,0 +1,61 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package charts_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/charts"
+)
+
+var _ = Describe("Charts", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		for _, f := range []string{"rancher-2.8.3.tgz", "rancher-backup-103.0.0.tgz", "cert-manager-v1.14.4.tgz", "cert-manager-v1.13.0.tgz"} {
+			Expect(os.WriteFile(filepath.Join(dir, f), nil, 0644)).To(Succeed())
+		}
+	})
+
+	It("finds the archive of a chart", func() {
+		// Archives of other charts with the same prefix are ignored
+		Expect(charts.Chart{Name: "rancher"}.Find(dir)).To(Equal(filepath.Join(dir, "rancher-2.8.3.tgz")))
+		Expect(charts.Chart{Name: "cert-manager", Version: "v1.13.0"}.Find(dir)).To(Equal(filepath.Join(dir, "cert-manager-v1.13.0.tgz")))
+	})
+
+	It("fails if the archive cannot be chosen", func() {
+		_, err := charts.Chart{Name: "elemental-operator-chart"}.Find(dir)
+		Expect(err).To(MatchError(charts.ErrNotFound))
+
+		_, err = charts.Chart{Name: "rancher", Version: "2.9.0"}.Find(dir)
+		Expect(err).To(MatchError(charts.ErrNotFound))
+
+		_, err = charts.Chart{Name: "cert-manager"}.Find(dir)
+		Expect(err).To(MatchError(charts.ErrAmbiguous))
+	})
+
+	It("pulls from an URL or an OCI registry", func() {
+		Expect(charts.Chart{Name: "rancher", Repo: "https://releases.rancher.com/server-charts/latest", Version: "2.8.3"}.PullArgs(dir)).To(Equal([]string{
+			"pull", "rancher", "--repo", "https://releases.rancher.com/server-charts/latest", "--version", "2.8.3", "--destination", dir,
+		}))
+		Expect(charts.Chart{Name: "elemental-operator-chart", Repo: "oci://registry.example.com/charts/"}.PullArgs(dir)).To(Equal([]string{
+			"pull", "oci://registry.example.com/charts/elemental-operator-chart", "--destination", dir,
+		}))
+	})
+})
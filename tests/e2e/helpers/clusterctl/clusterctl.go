@@ -0,0 +1,259 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterctl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Provider types, as used in the clusterctl configuration
+const (
+	TypeBootstrap      = "BootstrapProvider"
+	TypeControlPlane   = "ControlPlaneProvider"
+	TypeInfrastructure = "InfrastructureProvider"
+)
+
+// File describing the release series of a provider version
+const metadataFile = "metadata.yaml"
+
+// ErrNotFound is returned when a provider version is not stored in the repository
+var ErrNotFound = errors.New("provider version not found")
+
+// Provider is a CAPI provider stored in a local clusterctl repository
+type Provider struct {
+	Name      string
+	Namespace string
+	Type      string
+	Version   string
+	// Flavor of the cluster template, only used by infrastructure providers
+	Flavor string
+}
+
+// prefix returns the prefix of the provider label and components file
+func (p Provider) prefix() string {
+	switch p.Type {
+	case TypeBootstrap:
+		return "bootstrap"
+	case TypeControlPlane:
+		return "control-plane"
+	default:
+		return "infrastructure"
+	}
+}
+
+/*
+Get the label of the provider, also the name of its clusterctl Provider resource
+  - @returns The label, like infrastructure-elemental
+*/
+func (p Provider) Label() string {
+	return p.prefix() + "-" + p.Name
+}
+
+/*
+Get the clusterctl flag used to select the provider
+  - @returns The flag, like --infrastructure
+*/
+func (p Provider) Flag() string {
+	return "--" + p.prefix()
+}
+
+/*
+Get the provider with its version, as used by clusterctl init
+  - @returns The provider, like elemental:v0.5.0
+*/
+func (p Provider) String() string {
+	return p.Name + ":" + p.Version
+}
+
+/*
+Get the provider with its namespace and version, as used by clusterctl upgrade apply
+  - @returns The provider, like elemental-system/elemental:v0.5.0
+*/
+func (p Provider) UpgradeRef() string {
+	return p.Namespace + "/" + p.String()
+}
+
+// series returns the major and minor numbers of the version, like 0 and 5 for v0.5.0
+func (p Provider) series() (int, int, error) {
+	parts := strings.SplitN(strings.TrimPrefix(p.Version, "v"), ".", 3)
+	if len(parts) != 3 {
+		return 0, 0, fmt.Errorf("invalid version %q of %s", p.Version, p.Label())
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version %q of %s: %w", p.Version, p.Label(), err)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version %q of %s: %w", p.Version, p.Label(), err)
+	}
+
+	return major, minor, nil
+}
+
+/*
+Get the directory of the provider version in a local repository
+  - @param repo Directory of the local repository
+  - @returns Path of the directory
+*/
+func (p Provider) Dir(repo string) string {
+	return filepath.Join(repo, p.Label(), p.Version)
+}
+
+/*
+Get the components file of the provider version in a local repository
+  - @param repo Directory of the local repository
+  - @returns Path of the components file
+*/
+func (p Provider) ComponentsFile(repo string) string {
+	return filepath.Join(p.Dir(repo), p.prefix()+"-components.yaml")
+}
+
+/*
+Get the cluster template file of the provider version in a local repository
+  - @param repo Directory of the local repository
+  - @returns Path of the template file, the default one if no flavor is set
+*/
+func (p Provider) TemplateFile(repo string) string {
+	if p.Flavor == "" {
+		return filepath.Join(p.Dir(repo), "cluster-template.yaml")
+	}
+
+	return filepath.Join(p.Dir(repo), "cluster-template-"+p.Flavor+".yaml")
+}
+
+/*
+Check that the provider version is stored in a local repository
+NOTE: the cluster template is also needed for infrastructure providers, see clusterctl generate cluster
+  - @param repo Directory of the local repository
+  - @returns Nothing or an error
+*/
+func (p Provider) Check(repo string) error {
+	files := []string{p.ComponentsFile(repo), filepath.Join(p.Dir(repo), metadataFile)}
+	if p.Type == TypeInfrastructure {
+		files = append(files, p.TemplateFile(repo))
+	}
+
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			return fmt.Errorf("%w: %s %s (%s)", ErrNotFound, p.Label(), p.Version, err)
+		}
+	}
+
+	return nil
+}
+
+/*
+Add a provider version in a local repository
+NOTE: a metadata file is written for the version, so any version can be used for a development build
+  - @param repo Directory of the local repository
+  - @param p Provider to add
+  - @param src Directory containing the components file and the cluster templates of the provider
+  - @param contract CAPI contract implemented by the provider, like v1beta1
+  - @returns Nothing or an error
+*/
+func AddProvider(repo string, p Provider, src, contract string) error {
+	major, minor, err := p.series()
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	dir := p.Dir(repo)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !e.Type().IsRegular() || e.Name() == metadataFile {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(src, e.Name()))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, e.Name()), data, 0644); err != nil {
+			return err
+		}
+	}
+
+	metadata, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "clusterctl.cluster.x-k8s.io/v1alpha3",
+		"kind":       "Metadata",
+		"releaseSeries": []map[string]interface{}{
+			{"major": major, "minor": minor, "contract": contract},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, metadataFile), metadata, 0644); err != nil {
+		return err
+	}
+
+	return p.Check(repo)
+}
+
+/*
+Write a clusterctl configuration using a local repository
+NOTE: clusterctl finds the other versions of the providers in the repository
+  - @param file Configuration file to write
+  - @param repo Directory of the local repository
+  - @param providers Providers to configure
+  - @returns Nothing or an error
+*/
+func WriteConfig(file, repo string, providers ...Provider) error {
+	type providerConfig struct {
+		Name string `yaml:"name"`
+		URL  string `yaml:"url"`
+		Type string `yaml:"type"`
+	}
+
+	repo, err := filepath.Abs(repo)
+	if err != nil {
+		return err
+	}
+
+	c := struct {
+		Providers []providerConfig `yaml:"providers"`
+	}{}
+	for _, p := range providers {
+		c.Providers = append(c.Providers, providerConfig{
+			Name: p.Name,
+			URL:  "file://" + p.ComponentsFile(repo),
+			Type: p.Type,
+		})
+	}
+
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, out, 0644)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterctl_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/clusterctl"
+)
+
+var _ = Describe("Local clusterctl repository", func() {
+	var (
+		repo      string
+		elemental clusterctl.Provider
+		rke2      clusterctl.Provider
+	)
+
+	BeforeEach(func() {
+		repo = GinkgoT().TempDir()
+		elemental = clusterctl.Provider{Name: "elemental", Namespace: "elemental-system", Type: clusterctl.TypeInfrastructure, Version: "v9.9.99", Flavor: "rke2"}
+		rke2 = clusterctl.Provider{Name: "rke2", Namespace: "rke2-control-plane-system", Type: clusterctl.TypeControlPlane, Version: "v0.5.0"}
+	})
+
+	It("names the provider like clusterctl", func() {
+		Expect(elemental.Label()).To(Equal("infrastructure-elemental"))
+		Expect(elemental.Flag()).To(Equal("--infrastructure"))
+		Expect(elemental.String()).To(Equal("elemental:v9.9.99"))
+		Expect(rke2.UpgradeRef()).To(Equal("rke2-control-plane-system/rke2:v0.5.0"))
+		Expect(rke2.ComponentsFile(repo)).To(Equal(filepath.Join(repo, "control-plane-rke2", "v0.5.0", "control-plane-components.yaml")))
+		Expect(elemental.TemplateFile(repo)).To(Equal(filepath.Join(repo, "infrastructure-elemental", "v9.9.99", "cluster-template-rke2.yaml")))
+	})
+
+	It("needs the cluster template of infrastructure providers", func() {
+		for _, p := range []clusterctl.Provider{elemental, rke2} {
+			Expect(os.MkdirAll(p.Dir(repo), 0755)).To(Succeed())
+			Expect(os.WriteFile(p.ComponentsFile(repo), nil, 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(p.Dir(repo), "metadata.yaml"), nil, 0644)).To(Succeed())
+		}
+
+		Expect(rke2.Check(repo)).To(Succeed())
+		Expect(elemental.Check(repo)).To(MatchError(clusterctl.ErrNotFound))
+
+		Expect(os.WriteFile(elemental.TemplateFile(repo), nil, 0644)).To(Succeed())
+		Expect(elemental.Check(repo)).To(Succeed())
+	})
+
+	It("adds a development build with its metadata", func() {
+		src := GinkgoT().TempDir()
+		for _, f := range []string{"infrastructure-components.yaml", "cluster-template-rke2.yaml", "metadata.yaml"} {
+			Expect(os.WriteFile(filepath.Join(src, f), []byte("kind: "+f+"\n"), 0644)).To(Succeed())
+		}
+		Expect(os.Mkdir(filepath.Join(src, "subdir"), 0755)).To(Succeed())
+
+		Expect(elemental.Check(repo)).To(MatchError(clusterctl.ErrNotFound))
+		Expect(clusterctl.AddProvider(repo, elemental, src, "v1beta1")).To(Succeed())
+		Expect(elemental.Check(repo)).To(Succeed())
+
+		Expect(filepath.Join(elemental.Dir(repo), "cluster-template-rke2.yaml")).To(BeARegularFile())
+		Expect(filepath.Join(elemental.Dir(repo), "subdir")).To(Not(BeADirectory()))
+
+		metadata, err := os.ReadFile(filepath.Join(elemental.Dir(repo), "metadata.yaml"))
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(metadata)).To(MatchYAML(`apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+kind: Metadata
+releaseSeries:
+  - major: 9
+    minor: 9
+    contract: v1beta1
+`))
+	})
+
+	It("rejects invalid versions", func() {
+		elemental.Version = "latest"
+		Expect(clusterctl.AddProvider(repo, elemental, GinkgoT().TempDir(), "v1beta1")).To(MatchError(ContainSubstring("invalid version")))
+	})
+
+	It("writes the configuration", func() {
+		file := filepath.Join(repo, "clusterctl.yaml")
+		Expect(clusterctl.WriteConfig(file, repo, elemental, rke2)).To(Succeed())
+
+		out, err := os.ReadFile(file)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(out)).To(MatchYAML(`providers:
+  - name: elemental
+    url: file://` + repo + `/infrastructure-elemental/v9.9.99/infrastructure-components.yaml
+    type: InfrastructureProvider
+  - name: rke2
+    url: file://` + repo + `/control-plane-rke2/v0.5.0/control-plane-components.yaml
+    type: ControlPlaneProvider
+`))
+	})
+})
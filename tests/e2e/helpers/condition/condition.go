@@ -0,0 +1,245 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package condition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+var (
+	// ErrUnknownKind is returned when no conditions are known for the kind
+	ErrUnknownKind = errors.New("unknown kind")
+
+	// ErrTimeout is returned when the conditions are not reached in time
+	ErrTimeout = errors.New("timed out waiting for conditions")
+)
+
+// GVK identifies the kind of a resource
+type GVK struct {
+	Group   string
+	Version string
+	Kind    string
+}
+
+// Supported kinds
+var (
+	Cluster          = GVK{Group: "cluster.x-k8s.io", Version: "v1beta1", Kind: "Cluster"}
+	ElementalHost    = GVK{Group: "infrastructure.cluster.x-k8s.io", Version: "v1beta1", Kind: "ElementalHost"}
+	ElementalMachine = GVK{Group: "infrastructure.cluster.x-k8s.io", Version: "v1beta1", Kind: "ElementalMachine"}
+	Machine          = GVK{Group: "cluster.x-k8s.io", Version: "v1beta1", Kind: "Machine"}
+	MachineInventory = GVK{Group: "elemental.cattle.io", Version: "v1beta1", Kind: "MachineInventory"}
+	ManagedOSImage   = GVK{Group: "elemental.cattle.io", Version: "v1beta1", Kind: "ManagedOSImage"}
+)
+
+// kindInfo contains what is needed to query and wait for a kind
+type kindInfo struct {
+	resource   string
+	conditions []elemental.Condition
+}
+
+// ready returns a list of conditions expected to be True
+func ready(types ...string) []elemental.Condition {
+	list := make([]elemental.Condition, 0, len(types))
+	for _, t := range types {
+		list = append(list, elemental.Condition{Type: t, Status: "True"})
+	}
+
+	return list
+}
+
+// kinds lists the supported kinds with their default conditions
+var kinds = map[GVK]kindInfo{
+	// Ready is not used, it also needs all the machines to be ready
+	Cluster: {
+		resource:   "clusters",
+		conditions: ready("ControlPlaneReady", "InfrastructureReady"),
+	},
+	ElementalHost: {
+		resource:   "elementalhosts",
+		conditions: ready("RegistrationReady", "InstallationReady", "BootstrapReady", "Ready"),
+	},
+	ElementalMachine: {
+		resource:   "elementalmachines",
+		conditions: ready("AssociationReady", "HostReady", "ProviderIDReady", "Ready"),
+	},
+	Machine: {
+		resource:   "machines",
+		conditions: ready("BootstrapReady", "InfrastructureReady", "Ready"),
+	},
+	MachineInventory: {
+		resource:   "machineinventories",
+		conditions: ready("Ready"),
+	},
+	ManagedOSImage: {
+		resource:   "managedosimages",
+		conditions: ready("Ready"),
+	},
+}
+
+// Resource returns the fully qualified resource name, as used by kubectl and elemental.Client
+func (g GVK) Resource() string {
+	k, ok := kinds[g]
+	if !ok {
+		return strings.ToLower(g.Kind)
+	}
+
+	return k.resource + "." + g.Version + "." + g.Group
+}
+
+func (g GVK) String() string {
+	return g.Kind + "." + g.Version + "." + g.Group
+}
+
+/*
+Get the default conditions of a kind
+  - @param g Kind of the resource
+  - @returns The conditions a ready resource has or an error
+*/
+func Defaults(g GVK) ([]elemental.Condition, error) {
+	k, ok := kinds[g]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKind, g)
+	}
+
+	return k.conditions, nil
+}
+
+// Object contains the fields of a resource used to check its conditions
+type Object struct {
+	Metadata elemental.ObjectMeta `json:"metadata"`
+	Status   struct {
+		Conditions []elemental.Condition `json:"conditions,omitempty"`
+	} `json:"status"`
+}
+
+// Source gives access to the resources to check
+type Source interface {
+	// Get returns the current state of the resource
+	Get(g GVK, ns, name string) (*Object, error)
+	// Watch sends each new state of the resource, the channel is closed when the watch ends
+	Watch(ctx context.Context, g GVK, ns, name string) (<-chan *Object, error)
+}
+
+// Waiter waits for resources to reach expected conditions
+type Waiter struct {
+	Source Source
+	// Interval between two checks when polling
+	Interval time.Duration
+	// Timeout of the whole wait
+	Timeout time.Duration
+}
+
+/*
+Create a waiter
+  - @param source Source of the resources, usually NewDynamic
+  - @param timeout Timeout of the wait
+  - @returns Pointer to the Waiter structure
+*/
+func NewWaiter(source Source, timeout time.Duration) *Waiter {
+	return &Waiter{
+		Source:   source,
+		Interval: 10 * time.Second,
+		Timeout:  timeout,
+	}
+}
+
+/*
+Wait for a resource to reach the expected conditions
+  - @param g Kind of the resource
+  - @param ns Namespace of the resource
+  - @param name Name of the resource
+  - @param expected Conditions to reach, default ones of the kind are used if empty
+  - @returns Nothing or an error with the last observed condition
+*/
+func (w *Waiter) Wait(g GVK, ns, name string, expected ...elemental.Condition) error {
+	defaults, err := Defaults(g)
+	if err != nil {
+		return err
+	}
+	if len(expected) == 0 {
+		expected = defaults
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.Timeout)
+	defer cancel()
+
+	last := "no state observed"
+	check := func(o *Object) bool {
+		var ok bool
+		ok, last = Match(o, expected)
+		return ok
+	}
+
+	// Watch as long as possible, then poll
+	if events, err := w.Source.Watch(ctx, g, ns, name); err == nil {
+		for o := range events {
+			if check(o) {
+				return nil
+			}
+		}
+	}
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		o, err := w.Source.Get(g, ns, name)
+		if err != nil {
+			last = err.Error()
+		} else if check(o) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s %s/%s: %s", ErrTimeout, g.Kind, ns, name, last)
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+Check the conditions of a resource
+  - @param o Resource to check
+  - @param expected Conditions to reach, reason is only checked if set
+  - @returns True if all the conditions match, otherwise a description of the first one that does not
+*/
+func Match(o *Object, expected []elemental.Condition) (bool, string) {
+	for _, e := range expected {
+		var current *elemental.Condition
+		for i := range o.Status.Conditions {
+			if o.Status.Conditions[i].Type == e.Type {
+				current = &o.Status.Conditions[i]
+				break
+			}
+		}
+
+		switch {
+		case current == nil:
+			return false, fmt.Sprintf("%s is not set", e.Type)
+		case !strings.EqualFold(current.Status, e.Status) || (e.Reason != "" && current.Reason != e.Reason):
+			return false, fmt.Sprintf("%s is %s (reason: %q, message: %q) instead of %s",
+				e.Type, current.Status, current.Reason, current.Message, e.Status)
+		}
+	}
+
+	return true, ""
+}
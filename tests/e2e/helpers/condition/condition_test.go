@@ -0,0 +1,117 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package condition_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/condition"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+func object(conditions ...elemental.Condition) *condition.Object {
+	o := &condition.Object{}
+	o.Status.Conditions = conditions
+
+	return o
+}
+
+var _ = Describe("Condition waiter", func() {
+	var (
+		src *condition.Fake
+		w   *condition.Waiter
+	)
+
+	readyHost := object(
+		elemental.Condition{Type: "RegistrationReady", Status: "True"},
+		elemental.Condition{Type: "InstallationReady", Status: "True"},
+		elemental.Condition{Type: "BootstrapReady", Status: "True"},
+		elemental.Condition{Type: "Ready", Status: "True"},
+	)
+
+	BeforeEach(func() {
+		src = &condition.Fake{}
+		w = &condition.Waiter{Source: src, Interval: time.Millisecond, Timeout: 50 * time.Millisecond}
+	})
+
+	It("fails on unknown kinds", func() {
+		err := w.Wait(condition.GVK{Group: "example.com", Version: "v1", Kind: "Foo"}, "ns", "foo")
+		Expect(err).To(MatchError(condition.ErrUnknownKind))
+	})
+
+	It("has default conditions for all the supported kinds", func() {
+		for _, g := range []condition.GVK{
+			condition.Cluster,
+			condition.ElementalHost,
+			condition.ElementalMachine,
+			condition.Machine,
+			condition.MachineInventory,
+			condition.ManagedOSImage,
+		} {
+			c, err := condition.Defaults(g)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(c).To(Not(BeEmpty()))
+		}
+		Expect(condition.ElementalHost.Resource()).To(Equal("elementalhosts.v1beta1.infrastructure.cluster.x-k8s.io"))
+	})
+
+	It("returns as soon as a watch event matches", func() {
+		src.Events = []*condition.Object{object(), readyHost}
+
+		Expect(w.Wait(condition.ElementalHost, "ns", "node-001")).To(Succeed())
+	})
+
+	It("falls back to polling when the watch ends", func() {
+		src.Events = []*condition.Object{object()}
+		src.States = []*condition.Object{object(), readyHost}
+
+		Expect(w.Wait(condition.ElementalHost, "ns", "node-001")).To(Succeed())
+	})
+
+	It("polls when watch is not available", func() {
+		src.States = []*condition.Object{readyHost}
+
+		Expect(w.Wait(condition.ElementalHost, "ns", "node-001")).To(Succeed())
+	})
+
+	It("reports the last observed condition on timeout", func() {
+		src.States = []*condition.Object{object(
+			elemental.Condition{Type: "Ready", Status: "False", Reason: "Waiting", Message: "waiting for bootstrap"},
+		)}
+
+		err := w.Wait(condition.MachineInventory, "ns", "m-1")
+		Expect(err).To(MatchError(condition.ErrTimeout))
+		Expect(err.Error()).To(ContainSubstring("waiting for bootstrap"))
+	})
+
+	It("reports a missing resource on timeout", func() {
+		err := w.Wait(condition.Machine, "ns", "m-1")
+		Expect(err).To(MatchError(condition.ErrTimeout))
+		Expect(err.Error()).To(ContainSubstring("resource not found"))
+	})
+
+	It("checks the reason only when it is set", func() {
+		o := object(elemental.Condition{Type: "Ready", Status: "true", Reason: "Done"})
+
+		ok, _ := condition.Match(o, []elemental.Condition{{Type: "Ready", Status: "True"}})
+		Expect(ok).To(BeTrue())
+
+		ok, msg := condition.Match(o, []elemental.Condition{{Type: "Ready", Status: "True", Reason: "Other"}})
+		Expect(ok).To(BeFalse())
+		Expect(msg).To(ContainSubstring("Done"))
+	})
+})
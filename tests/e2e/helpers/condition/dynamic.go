@@ -0,0 +1,102 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package condition
+
+import (
+	"context"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Dynamic is a Source using the Kubernetes dynamic client
+type Dynamic struct {
+	client *elemental.Dynamic
+}
+
+/*
+Create a source backed by the Kubernetes dynamic client
+  - @param client Client to use
+  - @returns Pointer to the Dynamic structure
+*/
+func NewDynamic(client *elemental.Dynamic) *Dynamic {
+	return &Dynamic{client: client}
+}
+
+// Get returns the current state of the resource
+func (d *Dynamic) Get(g GVK, ns, name string) (*Object, error) {
+	o := &Object{}
+	if err := d.client.Get(g.Resource(), ns, name, o); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+/*
+Watch a resource
+  - @param ctx Context, the watch is stopped when it is done
+  - @param g Kind of the resource
+  - @param ns Namespace of the resource
+  - @param name Name of the resource
+  - @returns Channel receiving each state of the resource or an error
+*/
+func (d *Dynamic) Watch(ctx context.Context, g GVK, ns, name string) (<-chan *Object, error) {
+	r, err := d.client.Resource(g.Resource(), ns)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := r.Watch(ctx, metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String()})
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan *Object)
+	go func() {
+		defer close(events)
+		defer w.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-w.ResultChan():
+				// Deleted resources are not sent, the conditions cannot be reached
+				if !ok || e.Type == watch.Error {
+					return
+				}
+				if e.Type == watch.Deleted {
+					continue
+				}
+
+				o := &Object{}
+				if err := elemental.Decode(e.Object, o); err != nil {
+					return
+				}
+
+				select {
+				case events <- o:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package condition
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+// Fake is an in-memory Source, to be used in unit tests
+type Fake struct {
+	// States returned by Get, the last one is kept once all have been returned
+	States []*Object
+	// Events sent by Watch before closing the channel, Watch fails if nil
+	Events []*Object
+	mutex  sync.Mutex
+}
+
+// Get returns the next state
+func (f *Fake) Get(g GVK, ns, name string) (*Object, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.States) == 0 {
+		return nil, fmt.Errorf("%w: %s %s/%s", elemental.ErrNotFound, g.Kind, ns, name)
+	}
+
+	o := f.States[0]
+	if len(f.States) > 1 {
+		f.States = f.States[1:]
+	}
+
+	return o, nil
+}
+
+// Watch sends the events then closes the channel
+func (f *Fake) Watch(ctx context.Context, g GVK, ns, name string) (<-chan *Object, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.Events == nil {
+		return nil, fmt.Errorf("watch not supported for %s", g.Kind)
+	}
+
+	events := make(chan *Object, len(f.Events))
+	for _, o := range f.Events {
+		events <- o
+	}
+	close(events)
+
+	return events, nil
+}
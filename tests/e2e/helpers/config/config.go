@@ -0,0 +1,471 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Environment variable used to point to an optional configuration file
+	FileEnv = "E2E_CONFIG_FILE"
+
+	BootTypeISO = "iso"
+	BootTypePXE = "pxe"
+	BootTypeRaw = "raw"
+
+	OperatorTypeCAPI    = "capi"
+	OperatorTypeVanilla = "vanilla"
+
+	TestTypeMulti = "multi"
+)
+
+var (
+	bootTypes     = []string{BootTypeISO, BootTypePXE, BootTypeRaw}
+	operatorTypes = []string{OperatorTypeCAPI, OperatorTypeVanilla}
+)
+
+// ErrMissingValue is returned when a value needed by a spec is not set
+var ErrMissingValue = errors.New("missing value")
+
+// SuiteConfig holds the whole configuration of the test suite
+// NOTE: each field can be set in the configuration file (yaml tag) and
+// overwritten by an environment variable (env tag)
+type SuiteConfig struct {
+	BootType             string `yaml:"bootType" env:"BOOT_TYPE"`
+	BootstrapProvider    string `yaml:"bootstrapProvider" env:"BOOTSTRAP_PROVIDER"`
+	CAPIElementalVersion string `yaml:"capiElementalVersion" env:"CAPI_ELEMENTAL_VERSION"`
+	CAPIRKE2Version      string `yaml:"capiRKE2Version" env:"CAPI_RKE2_VERSION"`
+	CertManagerVersion   string `yaml:"certManagerVersion" env:"CERT_MANAGER_VERSION"`
+	ClusterName          string `yaml:"clusterName" env:"CLUSTER_NAME"`
+	ClusterNS            string `yaml:"clusterNS" env:"CLUSTER_NS"`
+	ClusterNumber        int    `yaml:"clusterNumber" env:"CLUSTER_NUMBER"`
+	ClusterType          string `yaml:"clusterType" env:"CLUSTER_TYPE"`
+	ControlPlaneCount    int    `yaml:"controlPlaneCount" env:"CONTROL_PLANE_COUNT"`
+	ControlPlaneProvider string `yaml:"controlPlaneProvider" env:"CONTROL_PLANE_PROVIDER"`
+	ElementalAPIEndpoint string `yaml:"elementalAPIEndpoint" env:"ELEMENTAL_API_ENDPOINT"`
+	ElementalSupport     string `yaml:"elementalSupport" env:"ELEMENTAL_SUPPORT"`
+	EmulateTPM           bool   `yaml:"emulateTPM" env:"EMULATE_TPM"`
+	HostMemoryReserved   int    `yaml:"hostMemoryReserved" env:"HOST_MEMORY_RESERVED"`
+	K8sDownstreamVersion string `yaml:"k8sDownstreamVersion" env:"K8S_DOWNSTREAM_VERSION"`
+	K8sUpstreamVersion   string `yaml:"k8sUpstreamVersion" env:"K8S_UPSTREAM_VERSION"`
+	MaxHostLoad          int    `yaml:"maxHostLoad" env:"MAX_HOST_LOAD"`
+	MaxInFlight          int    `yaml:"maxInFlight" env:"MAX_IN_FLIGHT"`
+	MinHostMemory        int    `yaml:"minHostMemory" env:"MIN_HOST_MEMORY"`
+	OperatorRepo         string `yaml:"operatorRepo" env:"OPERATOR_REPO"`
+	OperatorType         string `yaml:"operatorType" env:"OPERATOR_TYPE"`
+	RancherHostname      string `yaml:"rancherHostname" env:"RANCHER_HOSTNAME"`
+	RancherVersion       string `yaml:"rancherVersion" env:"RANCHER_VERSION"`
+	ScaleNodes           int    `yaml:"scaleNodes" env:"SCALE_NODES"`
+	TestType             string `yaml:"testType" env:"TEST_TYPE"`
+	UpgradeOSVersion     string `yaml:"upgradeOSVersion" env:"UPGRADE_OS_VERSION"`
+	UseHugepages         bool   `yaml:"useHugepages" env:"USE_HUGEPAGES"`
+	VMCPU                int    `yaml:"vmCPU" env:"VM_CPU"`
+	VMIndex              int    `yaml:"vmIndex" env:"VM_INDEX"`
+	VMMemory             int    `yaml:"vmMemory" env:"VM_MEM"`
+	VMNumbers            int    `yaml:"vmNumbers" env:"VM_NUMBERS"`
+	WorkerCount          int    `yaml:"workerCount" env:"WORKER_COUNT"`
+
+	// Versions used by the upgrade specs
+	CAPIElementalUpgradeVersion string `yaml:"capiElementalUpgradeVersion" env:"CAPI_ELEMENTAL_UPGRADE_VERSION"`
+	CAPIRKE2UpgradeVersion      string `yaml:"capiRKE2UpgradeVersion" env:"CAPI_RKE2_UPGRADE_VERSION"`
+	K8sDownstreamUpgradeVersion string `yaml:"k8sDownstreamUpgradeVersion" env:"K8S_DOWNSTREAM_UPGRADE_VERSION"`
+	OperatorUpgradeVersion      string `yaml:"operatorUpgradeVersion" env:"OPERATOR_UPGRADE_VERSION"`
+}
+
+/*
+Load the suite configuration
+  - @param file Optional YAML/JSON configuration file, environment variables take precedence over it
+  - @returns The validated configuration or an error listing all the invalid values
+*/
+func Load(file string) (*SuiteConfig, error) {
+	// Default values
+	// NOTE: keep 24GB by default for the hypervisor/Rancher Manager Server
+	// NOTE: cluster name is the same as in the CI workflows, for local runs
+	c := &SuiteConfig{
+		ClusterName:        "elemental-cluster",
+		ControlPlaneCount:  1,
+		HostMemoryReserved: 24576,
+		MaxInFlight:        30,
+		RancherHostname:    "192.168.122.100.sslip.io",
+		ScaleNodes:         2,
+		VMCPU:              4,
+		VMMemory:           4096,
+		WorkerCount:        AutoWorkers,
+
+		// NOTE: the compiled elemental provider is upgraded to a version higher than any release
+		CAPIElementalUpgradeVersion: "v9.9.99",
+		CAPIRKE2Version:             "v0.5.0",
+		CAPIRKE2UpgradeVersion:      "v0.6.0",
+	}
+
+	// Collect all errors to report them at once
+	var errs []error
+	if file != "" {
+		if err := c.loadFile(file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, c.loadEnv()...)
+
+	c.setDefaults()
+	errs = append(errs, c.validate()...)
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid suite configuration:\n%w", errors.Join(errs...))
+	}
+
+	return c, nil
+}
+
+/*
+Check that the VM range is set
+NOTE: only needed by the specs using the nodes, so it is not required by Load
+  - @returns Nothing or an error wrapping ErrMissingValue
+*/
+func (c *SuiteConfig) CheckVMRange() error {
+	if !c.hasVMRange() {
+		return fmt.Errorf("VM_INDEX/VM_NUMBERS: %w", ErrMissingValue)
+	}
+
+	return nil
+}
+
+// hasVMRange reports if the VM range is set, VMNumbers defaults to VMIndex
+func (c *SuiteConfig) hasVMRange() bool {
+	return c.VMNumbers > 0
+}
+
+/*
+Number of nodes used by the test
+  - @returns The number of nodes between VMIndex and VMNumbers (included)
+*/
+func (c *SuiteConfig) UsedNodes() int {
+	// NOTE: could be the number added nodes or the number of nodes to use/upgrade
+	return (c.VMNumbers - c.VMIndex) + 1
+}
+
+// AutoWorkers lets the test choose the number of workers, see Clusters
+const AutoWorkers = -1
+
+// Number of workers of a single cluster with AutoWorkers
+const defaultWorkers = 2
+
+// Cluster is a cluster deployed by the test with the range of nodes it uses
+type Cluster struct {
+	Name      string
+	VMIndex   int
+	VMNumbers int
+	// Number of control plane and worker machines
+	ControlPlanes int
+	Workers       int
+}
+
+/*
+Number of machines of the cluster
+  - @returns The number of control plane and worker machines
+*/
+func (c Cluster) Machines() int {
+	return c.ControlPlanes + c.Workers
+}
+
+/*
+Number of nodes used by the cluster
+  - @returns The number of nodes between VMIndex and VMNumbers (included)
+*/
+func (c Cluster) UsedNodes() int {
+	return (c.VMNumbers - c.VMIndex) + 1
+}
+
+/*
+Clusters deployed by the test
+NOTE: with multi-cluster test the nodes are split between the clusters,
+the first clusters getting one more node if they cannot be equally split
+  - @returns ClusterName with all the nodes, or ClusterNumber clusters named ClusterName-1..N
+*/
+func (c *SuiteConfig) Clusters() []Cluster {
+	if c.TestType != TestTypeMulti {
+		return []Cluster{c.newCluster(c.ClusterName, c.VMIndex, c.VMNumbers)}
+	}
+
+	clusters := make([]Cluster, 0, c.ClusterNumber)
+	size, remainder := c.UsedNodes()/c.ClusterNumber, c.UsedNodes()%c.ClusterNumber
+	index := c.VMIndex
+	for i := 1; i <= c.ClusterNumber; i++ {
+		n := size
+		if i <= remainder {
+			n++
+		}
+		clusters = append(clusters, c.newCluster(c.ClusterName+"-"+strconv.Itoa(i), index, index+n-1))
+		index += n
+	}
+
+	return clusters
+}
+
+/*
+Create a cluster using a range of nodes
+  - @param name Name of the cluster
+  - @param first Index of the first node
+  - @param last Index of the last node
+  - @returns The cluster, with defaultWorkers workers if WorkerCount is AutoWorkers
+    or all the nodes not used by the control plane as workers with multi-cluster
+*/
+func (c *SuiteConfig) newCluster(name string, first, last int) Cluster {
+	cl := Cluster{
+		Name:          name,
+		VMIndex:       first,
+		VMNumbers:     last,
+		ControlPlanes: c.ControlPlaneCount,
+		Workers:       c.WorkerCount,
+	}
+	if cl.Workers == AutoWorkers {
+		// NOTE: with a single cluster the other nodes are kept available, for scaling or replacement
+		cl.Workers = defaultWorkers
+		if c.TestType == TestTypeMulti {
+			cl.Workers = max(cl.UsedNodes()-cl.ControlPlanes, 0)
+		}
+	}
+
+	return cl
+}
+
+/*
+Check if the control plane is highly available
+  - @returns True if there are at least 3 control plane nodes
+*/
+func (c *SuiteConfig) HA() bool {
+	return c.ControlPlaneCount >= 3
+}
+
+/*
+Get the cluster a node belongs to
+  - @param index Index of the node
+  - @returns The cluster, false if the node is not used by any cluster
+*/
+func (c *SuiteConfig) ClusterOf(index int) (Cluster, bool) {
+	for _, cl := range c.Clusters() {
+		if index >= cl.VMIndex && index <= cl.VMNumbers {
+			return cl, true
+		}
+	}
+
+	return Cluster{}, false
+}
+
+// String returns the effective configuration in YAML format
+func (c *SuiteConfig) String() string {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(out)
+}
+
+/*
+Load configuration from file
+  - @param file YAML/JSON file to read (JSON is a subset of YAML)
+  - @returns Nothing or an error
+*/
+func (c *SuiteConfig) loadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Unknown keys are most likely typos, so don't ignore them
+	d := yaml.NewDecoder(f)
+	d.KnownFields(true)
+	if err := d.Decode(c); err != nil {
+		return fmt.Errorf("cannot parse %s: %w", file, err)
+	}
+
+	return nil
+}
+
+/*
+Load configuration from environment variables
+  - @returns A list of parsing errors, empty if all values are valid
+*/
+func (c *SuiteConfig) loadEnv() []error {
+	var errs []error
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		value, ok := os.LookupEnv(name)
+		if name == "" || !ok || value == "" {
+			continue
+		}
+
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a valid boolean", name, value))
+				continue
+			}
+			f.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a valid integer", name, value))
+				continue
+			}
+			f.SetInt(int64(n))
+		}
+	}
+
+	return errs
+}
+
+// setDefaults sets the default values for unset fields
+func (c *SuiteConfig) setDefaults() {
+	if c.BootType == "" {
+		c.BootType = BootTypePXE
+	}
+
+	if c.OperatorType == "" {
+		c.OperatorType = OperatorTypeCAPI
+	}
+
+	// NOTE: Rancher provisions the clusters of the default Fleet workspace, the CAPI
+	// namespace is the same as in the CI workflows, for local runs
+	if c.ClusterNS == "" {
+		c.ClusterNS = "e2e-ci-tests"
+		if c.OperatorType == OperatorTypeVanilla {
+			c.ClusterNS = "fleet-default"
+		}
+	}
+
+	if c.VMIndex > 0 && c.VMNumbers == 0 {
+		// By default set to VMIndex
+		c.VMNumbers = c.VMIndex
+	}
+
+	if c.TestType == TestTypeMulti && c.ClusterNumber == 0 {
+		c.ClusterNumber = 2
+	}
+}
+
+/*
+Validate the configuration
+  - @returns A list of validation errors, empty if the configuration is valid
+*/
+func (c *SuiteConfig) validate() []error {
+	var errs []error
+
+	// Check enumerations
+	if !slices.Contains(bootTypes, c.BootType) {
+		errs = append(errs, fmt.Errorf("BOOT_TYPE: %q is not one of %s", c.BootType, strings.Join(bootTypes, "/")))
+	}
+	if !slices.Contains(operatorTypes, c.OperatorType) {
+		errs = append(errs, fmt.Errorf("OPERATOR_TYPE: %q is not one of %s", c.OperatorType, strings.Join(operatorTypes, "/")))
+	}
+
+	// Check VM resources
+	if c.VMCPU <= 0 {
+		errs = append(errs, fmt.Errorf("VM_CPU: %d must be positive", c.VMCPU))
+	}
+	if c.VMMemory <= 0 {
+		errs = append(errs, fmt.Errorf("VM_MEM: %d must be positive", c.VMMemory))
+	}
+
+	// Check admission of the nodes
+	if c.MaxInFlight <= 0 {
+		errs = append(errs, fmt.Errorf("MAX_IN_FLIGHT: %d must be positive", c.MaxInFlight))
+	}
+	if c.MaxHostLoad < 0 {
+		errs = append(errs, fmt.Errorf("MAX_HOST_LOAD: %d cannot be negative", c.MaxHostLoad))
+	}
+	if c.MinHostMemory < 0 {
+		errs = append(errs, fmt.Errorf("MIN_HOST_MEMORY: %d cannot be negative", c.MinHostMemory))
+	}
+
+	// NOTE: only the CAPI ISO can be built by the test, the vanilla one is a SeedImage
+	if c.OperatorType == OperatorTypeVanilla && c.BootType == BootTypeISO {
+		errs = append(errs, fmt.Errorf("BOOT_TYPE: %q cannot be used with OPERATOR_TYPE %q", c.BootType, c.OperatorType))
+	}
+
+	// Check CAPI upgrade, all the providers are upgraded
+	if c.OperatorType == OperatorTypeCAPI {
+		if c.CAPIElementalUpgradeVersion == "" {
+			errs = append(errs, errors.New("CAPI_ELEMENTAL_UPGRADE_VERSION: cannot be empty"))
+		}
+		if c.CAPIRKE2UpgradeVersion == "" {
+			errs = append(errs, errors.New("CAPI_RKE2_UPGRADE_VERSION: cannot be empty"))
+		}
+	}
+
+	// Check machines
+	// NOTE: etcd needs an odd number of members to keep the quorum
+	if c.ControlPlaneCount < 1 || c.ControlPlaneCount%2 == 0 {
+		errs = append(errs, fmt.Errorf("CONTROL_PLANE_COUNT: %d must be a positive odd number", c.ControlPlaneCount))
+	}
+	if c.WorkerCount < AutoWorkers {
+		errs = append(errs, fmt.Errorf("WORKER_COUNT: %d cannot be negative, except %d to choose it automatically", c.WorkerCount, AutoWorkers))
+	}
+
+	// Check scaling
+	if c.ScaleNodes < 0 {
+		errs = append(errs, fmt.Errorf("SCALE_NODES: %d cannot be negative", c.ScaleNodes))
+	}
+
+	// Check VM range
+	if c.VMIndex < 0 {
+		errs = append(errs, fmt.Errorf("VM_INDEX: %d cannot be negative", c.VMIndex))
+	}
+	if c.VMNumbers < c.VMIndex {
+		errs = append(errs, fmt.Errorf("VM_NUMBERS: %d cannot be lower than VM_INDEX (%d)", c.VMNumbers, c.VMIndex))
+	}
+
+	// Check multi-cluster
+	// NOTE: the ISO embeds the registration, so all nodes would join the same cluster
+	if c.TestType == TestTypeMulti {
+		if c.ClusterNumber < 1 || (c.hasVMRange() && c.ClusterNumber > c.UsedNodes()) {
+			errs = append(errs, fmt.Errorf("CLUSTER_NUMBER: %d must be between 1 and the number of nodes (%d)", c.ClusterNumber, c.UsedNodes()))
+		}
+		if c.BootType == BootTypeISO {
+			errs = append(errs, fmt.Errorf("BOOT_TYPE: %q cannot be used with TEST_TYPE %q", c.BootType, c.TestType))
+		}
+	}
+
+	// Each cluster needs enough nodes for its machines
+	// NOTE: the VM range is only set by the steps using the nodes, see CheckVMRange
+	if len(errs) == 0 && c.hasVMRange() {
+		for _, cl := range c.Clusters() {
+			if cl.Machines() > cl.UsedNodes() {
+				errs = append(errs, fmt.Errorf("CONTROL_PLANE_COUNT/WORKER_COUNT: %d+%d machines cannot fit in the %d nodes of cluster %s",
+					cl.ControlPlanes, cl.Workers, cl.UsedNodes(), cl.Name))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,232 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+)
+
+var _ = Describe("Suite configuration", func() {
+	BeforeEach(func() {
+		GinkgoT().Setenv("CLUSTER_NAME", "cluster")
+		GinkgoT().Setenv("CLUSTER_NS", "fleet-default")
+		GinkgoT().Setenv("VM_INDEX", "1")
+		GinkgoT().Setenv("VM_NUMBERS", "7")
+	})
+
+	It("uses one control plane and two workers for a single cluster", func() {
+		c, err := config.Load("")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.Clusters()).To(Equal([]config.Cluster{{Name: "cluster", VMIndex: 1, VMNumbers: 7, ControlPlanes: 1, Workers: 2}}))
+		Expect(c.HA()).To(BeFalse())
+	})
+
+	It("splits the nodes between the clusters", func() {
+		GinkgoT().Setenv("TEST_TYPE", config.TestTypeMulti)
+		GinkgoT().Setenv("CLUSTER_NUMBER", "3")
+
+		c, err := config.Load("")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.Clusters()).To(Equal([]config.Cluster{
+			{Name: "cluster-1", VMIndex: 1, VMNumbers: 3, ControlPlanes: 1, Workers: 2},
+			{Name: "cluster-2", VMIndex: 4, VMNumbers: 5, ControlPlanes: 1, Workers: 1},
+			{Name: "cluster-3", VMIndex: 6, VMNumbers: 7, ControlPlanes: 1, Workers: 1},
+		}))
+
+		cl, ok := c.ClusterOf(5)
+		Expect(ok).To(BeTrue())
+		Expect(cl.Name).To(Equal("cluster-2"))
+		Expect(cl.UsedNodes()).To(Equal(2))
+
+		_, ok = c.ClusterOf(8)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("rejects invalid multi-cluster configurations", func() {
+		GinkgoT().Setenv("TEST_TYPE", config.TestTypeMulti)
+		GinkgoT().Setenv("CLUSTER_NUMBER", "8")
+		GinkgoT().Setenv("BOOT_TYPE", config.BootTypeISO)
+
+		_, err := config.Load("")
+		Expect(err).To(MatchError(ContainSubstring("CLUSTER_NUMBER: 8")))
+		Expect(err).To(MatchError(ContainSubstring("BOOT_TYPE")))
+	})
+
+	It("uses the requested number of machines", func() {
+		GinkgoT().Setenv("CONTROL_PLANE_COUNT", "3")
+		GinkgoT().Setenv("WORKER_COUNT", "2")
+
+		c, err := config.Load("")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.HA()).To(BeTrue())
+
+		cl := c.Clusters()[0]
+		Expect(cl.ControlPlanes).To(Equal(3))
+		Expect(cl.Workers).To(Equal(2))
+		Expect(cl.Machines()).To(Equal(5))
+	})
+
+	It("accepts clusters without workers", func() {
+		GinkgoT().Setenv("WORKER_COUNT", "0")
+
+		c, err := config.Load("")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.Clusters()[0].Machines()).To(Equal(1))
+
+		GinkgoT().Setenv("WORKER_COUNT", "-2")
+		_, err = config.Load("")
+		Expect(err).To(MatchError(ContainSubstring("WORKER_COUNT: -2 cannot be negative")))
+	})
+
+	It("rejects machines not fitting in the nodes", func() {
+		GinkgoT().Setenv("CONTROL_PLANE_COUNT", "2")
+		_, err := config.Load("")
+		Expect(err).To(MatchError(ContainSubstring("CONTROL_PLANE_COUNT: 2 must be a positive odd number")))
+
+		GinkgoT().Setenv("CONTROL_PLANE_COUNT", "3")
+		GinkgoT().Setenv("WORKER_COUNT", "5")
+		_, err = config.Load("")
+		Expect(err).To(MatchError(ContainSubstring("3+5 machines cannot fit in the 7 nodes of cluster cluster")))
+	})
+
+	It("uses the default cluster name and namespace", func() {
+		GinkgoT().Setenv("CLUSTER_NAME", "")
+		GinkgoT().Setenv("CLUSTER_NS", "")
+
+		c, err := config.Load("")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.ClusterName).To(Equal("elemental-cluster"))
+		Expect(c.ClusterNS).To(Equal("e2e-ci-tests"))
+	})
+
+	It("uses the default Fleet workspace with the vanilla operator", func() {
+		GinkgoT().Setenv("CLUSTER_NS", "")
+		GinkgoT().Setenv("OPERATOR_TYPE", config.OperatorTypeVanilla)
+
+		c, err := config.Load("")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.ClusterNS).To(Equal("fleet-default"))
+
+		GinkgoT().Setenv("BOOT_TYPE", config.BootTypeISO)
+		_, err = config.Load("")
+		Expect(err).To(MatchError(ContainSubstring(`BOOT_TYPE: "iso" cannot be used with OPERATOR_TYPE "vanilla"`)))
+	})
+
+	It("upgrades all the CAPI providers", func() {
+		c, err := config.Load("")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.CAPIRKE2UpgradeVersion).To(Equal("v0.6.0"))
+
+		file := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		err = os.WriteFile(file, []byte("capiRKE2UpgradeVersion: \"\"\n"), 0o644)
+		Expect(err).To(Not(HaveOccurred()))
+		_, err = config.Load(file)
+		Expect(err).To(MatchError(ContainSubstring("CAPI_RKE2_UPGRADE_VERSION: cannot be empty")))
+	})
+
+	It("loads the configuration file", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		err := os.WriteFile(file, []byte("clusterName: from-file\nvmCPU: 8\nemulateTPM: true\n"), 0o644)
+		Expect(err).To(Not(HaveOccurred()))
+		GinkgoT().Setenv("CLUSTER_NAME", "")
+
+		c, err := config.Load(file)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.ClusterName).To(Equal("from-file"))
+		Expect(c.VMCPU).To(Equal(8))
+		Expect(c.EmulateTPM).To(BeTrue())
+		// Not set in the file, default value is kept
+		Expect(c.VMMemory).To(Equal(4096))
+	})
+
+	It("overrides the configuration file with environment variables", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		err := os.WriteFile(file, []byte("clusterName: from-file\nvmCPU: 8\n"), 0o644)
+		Expect(err).To(Not(HaveOccurred()))
+		GinkgoT().Setenv("VM_CPU", "2")
+
+		c, err := config.Load(file)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.ClusterName).To(Equal("cluster"))
+		Expect(c.VMCPU).To(Equal(2))
+	})
+
+	It("rejects unknown keys in the configuration file", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		err := os.WriteFile(file, []byte("vmCPUs: 8\n"), 0o644)
+		Expect(err).To(Not(HaveOccurred()))
+
+		_, err = config.Load(file)
+		Expect(err).To(MatchError(ContainSubstring("field vmCPUs not found")))
+
+		_, err = config.Load(filepath.Join(GinkgoT().TempDir(), "missing.yaml"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reports all the invalid values at once", func() {
+		GinkgoT().Setenv("EMULATE_TPM", "maybe")
+		GinkgoT().Setenv("VM_CPU", "four")
+		GinkgoT().Setenv("BOOT_TYPE", "usb")
+		GinkgoT().Setenv("OPERATOR_TYPE", "other")
+
+		_, err := config.Load("")
+		Expect(err).To(MatchError(ContainSubstring(`EMULATE_TPM: "maybe" is not a valid boolean`)))
+		Expect(err).To(MatchError(ContainSubstring(`VM_CPU: "four" is not a valid integer`)))
+		Expect(err).To(MatchError(ContainSubstring(`BOOT_TYPE: "usb" is not one of iso/pxe/raw`)))
+		Expect(err).To(MatchError(ContainSubstring(`OPERATOR_TYPE: "other" is not one of capi/vanilla`)))
+
+		// Errors of the configuration file are reported with the other ones
+		file := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		err = os.WriteFile(file, []byte("vmCPUs: 8\n"), 0o644)
+		Expect(err).To(Not(HaveOccurred()))
+
+		_, err = config.Load(file)
+		Expect(err).To(MatchError(ContainSubstring("field vmCPUs not found")))
+		Expect(err).To(MatchError(ContainSubstring(`EMULATE_TPM: "maybe" is not a valid boolean`)))
+	})
+
+	It("reports a missing VM range", func() {
+		c, err := config.Load("")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.CheckVMRange()).To(Succeed())
+
+		GinkgoT().Setenv("VM_INDEX", "")
+		GinkgoT().Setenv("VM_NUMBERS", "")
+		c, err = config.Load("")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(c.CheckVMRange()).To(MatchError(config.ErrMissingValue))
+	})
+
+	It("does not check the machines without a VM range", func() {
+		// Like the installation steps, which don't use the nodes
+		GinkgoT().Setenv("VM_INDEX", "")
+		GinkgoT().Setenv("VM_NUMBERS", "")
+		GinkgoT().Setenv("CONTROL_PLANE_COUNT", "3")
+		GinkgoT().Setenv("TEST_TYPE", config.TestTypeMulti)
+		GinkgoT().Setenv("CLUSTER_NUMBER", "2")
+
+		_, err := config.Load("")
+		Expect(err).To(Not(HaveOccurred()))
+
+		GinkgoT().Setenv("CONTROL_PLANE_COUNT", "2")
+		_, err = config.Load("")
+		Expect(err).To(MatchError(ContainSubstring("CONTROL_PLANE_COUNT: 2 must be a positive odd number")))
+	})
+})
@@ -0,0 +1,312 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher/elemental/tests/e2e/helpers/vm"
+)
+
+// DefaultKinds lists the resources dumped by default
+var DefaultKinds = []string{
+	"elementalhosts.infrastructure.cluster.x-k8s.io",
+	"elementalmachines.infrastructure.cluster.x-k8s.io",
+	"elementalregistrations.infrastructure.cluster.x-k8s.io",
+	"clusters.cluster.x-k8s.io",
+	"machines.cluster.x-k8s.io",
+}
+
+// DefaultNamespaces lists the namespaces of the controllers
+var DefaultNamespaces = []string{
+	"elemental-system",
+	"capi-system",
+	"rke2-bootstrap-system",
+	"rke2-control-plane-system",
+}
+
+// Default limits of the node data collection
+const (
+	DefaultNodeTimeout  = 2 * time.Minute
+	DefaultJournalLines = 20000
+)
+
+// Node is a node to collect the journal from, tools.Client can be used
+type Node interface {
+	RunSSH(cmd string) (string, error)
+}
+
+// Collector gathers a diagnostics bundle, only local tools are used
+type Collector struct {
+	// Directory where the bundles are written
+	Dir string
+	// Resources to dump as YAML, in all namespaces
+	Kinds []string
+	// Namespaces to get the pod logs from
+	Namespaces []string
+	// Nodes to get the journal from, indexed by hostname
+	Nodes map[string]Node
+	// Maximum time to collect the data of one node, nodes are collected in parallel
+	NodeTimeout time.Duration
+	// Maximum number of journal lines to get from the current boot
+	JournalLines int
+	// Hypervisor to get the VMs data from, VM names are the node hostnames
+	Hypervisor vm.Hypervisor
+	// Kubectl executes kubectl, kubectl.RunWithoutErr if not set
+	Kubectl func(args ...string) (string, error)
+}
+
+/*
+Create a collector with the default resources and namespaces
+  - @param dir Directory where the bundles are written
+  - @returns Pointer to the Collector structure
+*/
+func NewCollector(dir string) *Collector {
+	return &Collector{
+		Dir:          dir,
+		Kinds:        DefaultKinds,
+		Namespaces:   DefaultNamespaces,
+		Nodes:        make(map[string]Node),
+		NodeTimeout:  DefaultNodeTimeout,
+		JournalLines: DefaultJournalLines,
+		Kubectl:      kubectl.RunWithoutErr,
+	}
+}
+
+/*
+Collect a diagnostics bundle
+  - @param name Name of the bundle, usually the failed spec
+  - @returns The path of the tarball and all the collection errors joined
+*/
+func (c *Collector) Collect(name string) (string, error) {
+	dir := filepath.Join(c.Dir, time.Now().Format("20060102-150405")+"-"+sanitize(name))
+
+	// Errors do not stop the collection, we want as much data as possible
+	// NOTE: nodes are collected in parallel, hence the mutex
+	var (
+		errs []error
+		mu   sync.Mutex
+	)
+	save := func(file, content string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+			// Partial output is still useful
+			if content == "" {
+				return
+			}
+		}
+		if err := writeFile(filepath.Join(dir, file), content); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	run := c.Kubectl
+	if run == nil {
+		run = kubectl.RunWithoutErr
+	}
+
+	for _, k := range c.Kinds {
+		out, err := run("get", k, "--all-namespaces", "-o", "yaml")
+		save(filepath.Join("resources", k+".yaml"), out, err)
+	}
+
+	for _, ns := range c.Namespaces {
+		pods, err := run("get", "pods", "--namespace", ns, "-o", "jsonpath={.items[*].metadata.name}")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pods in %s: %w", ns, err))
+			continue
+		}
+		for _, p := range strings.Fields(pods) {
+			out, err := run("logs", "--namespace", ns, p, "--all-containers", "--prefix")
+			save(filepath.Join("pods", ns, p+".log"), out, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for name, n := range c.Nodes {
+		wg.Add(1)
+		go func(name string, n Node) {
+			defer wg.Done()
+			c.collectNode(name, n, save)
+		}(name, n)
+	}
+	wg.Wait()
+
+	// Keep track of what could not be collected
+	if len(errs) > 0 {
+		save("errors.txt", errors.Join(errs...).Error()+"\n", nil)
+	}
+
+	tarball := dir + ".tar.gz"
+	if err := archive(dir, tarball); err != nil {
+		return "", errors.Join(append(errs, err)...)
+	}
+
+	return tarball, errors.Join(errs...)
+}
+
+/*
+Collect the data of one node, giving up after NodeTimeout
+  - @param name Hostname of the node, also the VM name
+  - @param n Node to get the journal from
+  - @param save Function used to save the collected data
+  - @returns Nothing, errors are given to save
+*/
+func (c *Collector) collectNode(name string, n Node, save func(file, content string, err error)) {
+	timeout := c.NodeTimeout
+	if timeout <= 0 {
+		timeout = DefaultNodeTimeout
+	}
+	lines := c.JournalLines
+	if lines <= 0 {
+		lines = DefaultJournalLines
+	}
+
+	// NOTE: SSH and hypervisor calls cannot be cancelled, a stuck call is
+	// abandoned and its result is dropped
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	call := func(file string, fn func() (string, error)) {
+		type result struct {
+			out string
+			err error
+		}
+
+		done := make(chan result, 1)
+		go func() {
+			out, err := fn()
+			done <- result{out, err}
+		}()
+
+		select {
+		case r := <-done:
+			save(file, r.out, r.err)
+		case <-ctx.Done():
+			save(file, "", fmt.Errorf("node %s: %w", name, ctx.Err()))
+		}
+	}
+
+	call(filepath.Join("nodes", name+"-journalctl.log"), func() (string, error) {
+		return n.RunSSH(fmt.Sprintf("journalctl --no-pager --boot --lines=%d", lines))
+	})
+
+	if c.Hypervisor == nil {
+		return
+	}
+	call(filepath.Join("vms", name+".xml"), func() (string, error) {
+		return c.Hypervisor.XML(name)
+	})
+	call(filepath.Join("vms", name+"-console.log"), func() (string, error) {
+		return c.Hypervisor.ConsoleLog(name)
+	})
+}
+
+// sanitize returns a name usable as a file name
+func sanitize(name string) string {
+	s := strings.Trim(regexp.MustCompile(`[^A-Za-z0-9._]+`).ReplaceAllString(name, "-"), "-")
+	if len(s) > 64 {
+		s = s[:64]
+	}
+
+	return s
+}
+
+// writeFile writes a file, creating the parent directories
+func writeFile(file, content string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, []byte(content), 0644)
+}
+
+/*
+Create a gzipped tarball of a directory
+  - @param dir Directory to archive
+  - @param tarball Path of the tarball
+  - @returns Nothing or an error
+*/
+func archive(dir, tarball string) error {
+	f, err := os.Create(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	base := filepath.Dir(dir)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		if hdr.Name, err = filepath.Rel(base, path); err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnostics_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/diagnostics"
+	"github.com/rancher/elemental/tests/e2e/helpers/vm"
+)
+
+type node struct {
+	journal string
+	err     error
+	cmd     string
+	block   chan struct{}
+}
+
+func (n *node) RunSSH(cmd string) (string, error) {
+	n.cmd = cmd
+	if n.block != nil {
+		<-n.block
+	}
+
+	return n.journal, n.err
+}
+
+// content returns the files of a tarball with their content
+func content(tarball string) map[string]string {
+	f, err := os.Open(tarball)
+	Expect(err).To(Not(HaveOccurred()))
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	Expect(err).To(Not(HaveOccurred()))
+
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		Expect(err).To(Not(HaveOccurred()))
+
+		out, err := io.ReadAll(tr)
+		Expect(err).To(Not(HaveOccurred()))
+
+		// Remove the timestamped directory
+		_, name, _ := strings.Cut(hdr.Name, "/")
+		if hdr.Typeflag == tar.TypeReg {
+			files[name] = string(out)
+		}
+	}
+
+	return files
+}
+
+var _ = Describe("Diagnostics collector", func() {
+	It("collects a bundle even if some data are missing", func() {
+		h := vm.NewFake()
+		Expect(h.Define(&vm.Options{
+			Name:     "node-001",
+			BootType: vm.BootPXE,
+			Disk:     "/tmp/node-001.img",
+			DiskSize: 30,
+			Memory:   4096,
+			CPU:      4,
+		})).To(Succeed())
+		h.VMs["node-001"].Console = "Welcome to Elemental"
+
+		c := diagnostics.NewCollector(GinkgoT().TempDir())
+		c.Kinds = []string{"elementalhosts"}
+		c.Namespaces = []string{"elemental-system"}
+		c.Hypervisor = h
+		c.Nodes["node-001"] = &node{journal: "elemental-agent started"}
+		c.Nodes["node-002"] = &node{err: errors.New("connection refused")}
+		c.Kubectl = func(args ...string) (string, error) {
+			switch {
+			case args[0] == "get" && args[1] == "pods":
+				return "elemental-controller", nil
+			case args[0] == "get":
+				return "kind: List", nil
+			default:
+				return "reconciling", nil
+			}
+		}
+
+		tarball, err := c.Collect("E2E - Bootstrapping node Provision the node")
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+		Expect(tarball).To(HaveSuffix("-E2E-Bootstrapping-node-Provision-the-node.tar.gz"))
+
+		files := content(tarball)
+		Expect(files).To(HaveKeyWithValue("resources/elementalhosts.yaml", "kind: List"))
+		Expect(files).To(HaveKeyWithValue("pods/elemental-system/elemental-controller.log", "reconciling"))
+		Expect(files).To(HaveKeyWithValue("nodes/node-001-journalctl.log", "elemental-agent started"))
+		Expect(files).To(HaveKeyWithValue("vms/node-001-console.log", "Welcome to Elemental"))
+		Expect(files).To(HaveKeyWithValue("vms/node-001.xml", ContainSubstring("<name>node-001</name>")))
+		Expect(files).To(HaveKeyWithValue("errors.txt", ContainSubstring("node-002")))
+	})
+
+	It("bounds the node journal and gives up on stuck nodes", func() {
+		stuck := &node{journal: "never returned", block: make(chan struct{})}
+		defer close(stuck.block)
+		n := &node{journal: "elemental-agent started"}
+
+		c := diagnostics.NewCollector(GinkgoT().TempDir())
+		c.Kinds = nil
+		c.Namespaces = nil
+		c.NodeTimeout = 100 * time.Millisecond
+		c.JournalLines = 500
+		c.Nodes["node-001"] = n
+		c.Nodes["node-002"] = stuck
+
+		start := time.Now()
+		tarball, err := c.Collect("stuck node")
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		Expect(err).To(MatchError(ContainSubstring("node node-002: context deadline exceeded")))
+		Expect(n.cmd).To(Equal("journalctl --no-pager --boot --lines=500"))
+
+		files := content(tarball)
+		Expect(files).To(HaveKeyWithValue("nodes/node-001-journalctl.log", "elemental-agent started"))
+		Expect(files).To(Not(HaveKey("nodes/node-002-journalctl.log")))
+	})
+})
@@ -0,0 +1,261 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	// ErrNotFound is returned when the requested resource does not exist
+	ErrNotFound = errors.New("resource not found")
+
+	// ErrFieldMissing is returned when the resource exists but the requested field is not set
+	ErrFieldMissing = errors.New("field missing")
+)
+
+// Client gives access to the Kubernetes resources needed by the helpers
+type Client interface {
+	// Get decodes the resource into obj
+	Get(kind, ns, name string, obj interface{}) error
+	// List decodes the items matching the label selector (may be empty) into list
+	List(kind, ns, selector string, list interface{}) error
+	// Label sets (or overwrites) a label on the resource
+	Label(kind, ns, name, key, value string) error
+}
+
+// Dynamic is a Client using the Kubernetes dynamic client
+// NOTE: the kubeconfig is loaded on first use, it may not exist when the client is created
+type Dynamic struct {
+	// Kubeconfig file to use, the default one (KUBECONFIG or ~/.kube/config) if empty
+	Kubeconfig string
+
+	client dynamic.Interface
+	// Kinds are resolved like kubectl does, from the API discovery
+	mapper meta.RESTMapper
+	mutex  sync.Mutex
+}
+
+/*
+Create a client backed by the Kubernetes dynamic client
+  - @param kubeconfig Kubeconfig file to use, the default one if empty
+  - @returns Pointer to the Dynamic structure
+*/
+func NewDynamic(kubeconfig string) *Dynamic {
+	return &Dynamic{Kubeconfig: kubeconfig}
+}
+
+// newDynamic creates a client from an existing dynamic client and mapper
+func newDynamic(client dynamic.Interface, mapper meta.RESTMapper) *Dynamic {
+	return &Dynamic{client: client, mapper: mapper}
+}
+
+/*
+Load the kubeconfig and create the clients, if not already done
+  - @returns Nothing or an error
+*/
+func (d *Dynamic) connect() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.client != nil {
+		return nil
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = d.Kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("cannot load kubeconfig: %w", err)
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	disc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	d.client = client
+	d.mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disc))
+
+	return nil
+}
+
+/*
+Get a resource
+  - @param kind Kind of the resource
+  - @param ns Namespace of the resource
+  - @param name Name of the resource
+  - @param obj Pointer to the structure to decode into
+  - @returns Nothing or an error, ErrNotFound if the resource does not exist
+*/
+func (d *Dynamic) Get(kind, ns, name string, obj interface{}) error {
+	r, err := d.Resource(kind, ns)
+	if err != nil {
+		return err
+	}
+
+	u, err := r.Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return notFound(err)
+	}
+
+	return Decode(u, obj)
+}
+
+/*
+List resources
+  - @param kind Kind of the resources
+  - @param ns Namespace of the resources
+  - @param selector Label selector, all the resources are listed if empty
+  - @param list Pointer to the list structure to decode into
+  - @returns Nothing or an error
+*/
+func (d *Dynamic) List(kind, ns, selector string, list interface{}) error {
+	r, err := d.Resource(kind, ns)
+	if err != nil {
+		return err
+	}
+
+	l, err := r.List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return err
+	}
+
+	return Decode(l, list)
+}
+
+/*
+Set a label on a resource
+  - @param kind Kind of the resource
+  - @param ns Namespace of the resource
+  - @param name Name of the resource
+  - @param key Label to set
+  - @param value Value to set on label
+  - @returns Nothing or an error, ErrNotFound if the resource does not exist
+*/
+func (d *Dynamic) Label(kind, ns, name, key, value string) error {
+	r, err := d.Resource(kind, ns)
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{key: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Patch(context.Background(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return notFound(err)
+}
+
+/*
+Get the dynamic client of a kind, to use the API not covered by Client (watch...)
+  - @param kind Kind of the resources, as used by kubectl (node, resource.group, resource.version.group...)
+  - @param ns Namespace of the resources, ignored if the kind is not namespaced
+  - @returns The client of the resources or an error
+*/
+func (d *Dynamic) Resource(kind, ns string) (dynamic.ResourceInterface, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	mapping, err := d.mapping(kind)
+	// Kind could be added after the discovery (CRD installed by the test)
+	if meta.IsNoMatchError(err) {
+		if r, ok := d.mapper.(meta.ResettableRESTMapper); ok {
+			r.Reset()
+			mapping, err = d.mapping(kind)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return d.client.Resource(mapping.Resource), nil
+	}
+
+	return d.client.Resource(mapping.Resource).Namespace(ns), nil
+}
+
+/*
+Resolve a kind
+  - @param kind Kind of the resources, as used by kubectl
+  - @returns The REST mapping of the kind or an error
+*/
+func (d *Dynamic) mapping(kind string) (*meta.RESTMapping, error) {
+	// Same resolution as kubectl, resource.version.group first then resource.group
+	full, partial := schema.ParseResourceArg(kind)
+	gvk := schema.GroupVersionKind{}
+	if full != nil {
+		gvk, _ = d.mapper.KindFor(*full)
+	}
+	if gvk.Empty() {
+		var err error
+		if gvk, err = d.mapper.KindFor(partial.WithVersion("")); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+/*
+Decode a resource returned by the dynamic client
+  - @param obj Resource or list of resources, as unstructured objects
+  - @param into Pointer to the structure to decode into
+  - @returns Nothing or an error
+*/
+func Decode(obj runtime.Object, into interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, into)
+}
+
+// notFound maps the NotFound API errors to ErrNotFound
+func notFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, err)
+	}
+
+	return err
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+)
+
+var (
+	hostGVK = schema.GroupVersionKind{Group: "infrastructure.cluster.x-k8s.io", Version: "v1beta1", Kind: "ElementalHost"}
+	nodeGVK = schema.GroupVersionKind{Version: "v1", Kind: "Node"}
+)
+
+func object(gvk schema.GroupVersionKind, ns, name string, labels map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	u.SetNamespace(ns)
+	u.SetName(name)
+	u.SetLabels(labels)
+
+	return u
+}
+
+var _ = Describe("Dynamic client", func() {
+	var d *Dynamic
+
+	BeforeEach(func() {
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(hostGVK, meta.RESTScopeNamespace)
+		mapper.Add(nodeGVK, meta.RESTScopeRoot)
+
+		scheme := runtime.NewScheme()
+		client := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(scheme,
+			map[schema.GroupVersionResource]string{
+				hostGVK.GroupVersion().WithResource("elementalhosts"): "ElementalHostList",
+				nodeGVK.GroupVersion().WithResource("nodes"):          "NodeList",
+			},
+			object(hostGVK, "fleet-default", "node-001", map[string]string{"role": "master"}),
+			object(hostGVK, "fleet-default", "node-002", nil),
+			object(nodeGVK, "", "node-001", nil),
+		)
+		d = newDynamic(client, mapper)
+	})
+
+	It("gets resources with the kinds used by kubectl", func() {
+		h := &ElementalHost{}
+		Expect(d.Get(KindElementalHost, "fleet-default", "node-001", h)).To(Succeed())
+		Expect(h.Metadata.Labels).To(HaveKeyWithValue("role", "master"))
+
+		Expect(d.Get("elementalhosts.v1beta1.infrastructure.cluster.x-k8s.io", "fleet-default", "node-002", h)).To(Succeed())
+		Expect(h.Metadata.Name).To(Equal("node-002"))
+
+		// Namespace is ignored for cluster scoped resources
+		n := &Node{}
+		Expect(d.Get(KindNode, "fleet-default", "node-001", n)).To(Succeed())
+		Expect(n.Metadata.Name).To(Equal("node-001"))
+	})
+
+	It("returns ErrNotFound for missing resources", func() {
+		err := d.Get(KindElementalHost, "fleet-default", "node-003", &ElementalHost{})
+		Expect(err).To(MatchError(ErrNotFound))
+
+		err = d.Label(KindElementalHost, "default", "node-001", "role", "worker")
+		Expect(err).To(MatchError(ErrNotFound))
+	})
+
+	It("does not return ErrNotFound for unknown kinds", func() {
+		err := d.Get("unknowns.example.com", "fleet-default", "node-001", &ElementalHost{})
+		Expect(err).To(HaveOccurred())
+		Expect(err).To(Not(MatchError(ErrNotFound)))
+		Expect(meta.IsNoMatchError(err)).To(BeTrue())
+	})
+
+	It("lists resources with a label selector", func() {
+		list := &ElementalHostList{}
+		Expect(d.List(KindElementalHost, "fleet-default", "", list)).To(Succeed())
+		Expect(list.Items).To(HaveLen(2))
+
+		Expect(d.List(KindElementalHost, "fleet-default", "role=master", list)).To(Succeed())
+		Expect(list.Items).To(HaveLen(1))
+		Expect(list.Items[0].Metadata.Name).To(Equal("node-001"))
+	})
+
+	It("sets labels", func() {
+		Expect(d.Label(KindElementalHost, "fleet-default", "node-002", "role", "worker")).To(Succeed())
+
+		h := &ElementalHost{}
+		Expect(d.Get(KindElementalHost, "fleet-default", "node-002", h)).To(Succeed())
+		Expect(h.Metadata.Labels).To(Equal(map[string]string{"role": "worker"}))
+	})
+})
@@ -16,9 +16,12 @@ package elemental
 
 import (
 	"fmt"
+	"hash/fnv"
+	"net"
+	"net/url"
 	"strings"
 
-	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
 	"gopkg.in/yaml.v3"
 )
 
@@ -50,111 +53,224 @@ func AddSelector(key, value string) ([]byte, error) {
 	return out, nil
 }
 
+/*
+Add node selector in a MachineInventorySelectorTemplate
+  - @param template YAML of the MachineInventorySelectorTemplate
+  - @param key Label to match
+  - @param value Value of the label
+  - @returns The YAML with the label added to the already matched ones or an error
+*/
+func AddSelectorToTemplate(template []byte, key, value string) ([]byte, error) {
+	s, err := AddSelector(key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	sel := struct {
+		NodeSelector map[string]interface{} `yaml:"nodeSelector"`
+	}{}
+	if err := yaml.Unmarshal(s, &sel); err != nil {
+		return nil, err
+	}
+
+	// Same selector, but at the place expected by the template
+	overlay, err := yaml.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"selector": sel.NodeSelector,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return assets.Merge(template, overlay)
+}
+
 /*
 Get state of the cluster
+  - @param k Kubernetes client
   - @param ns Namespace where the cluster is deployed
   - @param cluster Name of the cluster to check
-  - @param condition Status to search for
-  - @returns The YAML structure or an error
+  - @param condition Type of the condition to search for
+  - @returns The status of the condition or an error
 */
-func GetClusterState(ns, cluster, condition string) (string, error) {
-	out, err := kubectl.RunWithoutErr("get", "cluster.v1.provisioning.cattle.io", "--namespace", ns, cluster, "-o", "jsonpath="+condition)
-	if err != nil {
+func GetClusterState(k Client, ns, cluster, condition string) (string, error) {
+	c := &ProvisioningCluster{}
+	if err := k.Get(KindProvisioningCluster, ns, cluster, c); err != nil {
 		return "", err
 	}
-	return out, nil
+
+	for _, cond := range c.Status.Conditions {
+		if cond.Type == condition {
+			return cond.Status, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: condition %s in cluster %s", ErrFieldMissing, condition, cluster)
+}
+
+/*
+Get kubeconfig of a CAPI cluster
+  - @param k Kubernetes client
+  - @param ns Namespace where the cluster is deployed
+  - @param cluster Name of the cluster
+  - @returns The kubeconfig stored by CAPI in the <cluster>-kubeconfig secret or an error
+*/
+func GetClusterKubeconfig(k Client, ns, cluster string) ([]byte, error) {
+	s := &Secret{}
+	if err := k.Get(KindSecret, ns, cluster+"-kubeconfig", s); err != nil {
+		return nil, err
+	}
+
+	value, ok := s.Data["value"]
+	if !ok || len(value) == 0 {
+		return nil, fmt.Errorf("%w: value in secret %s-kubeconfig", ErrFieldMissing, cluster)
+	}
+
+	return value, nil
+}
+
+/*
+Get the nodes of the machines of a CAPI cluster
+  - @param k Kubernetes client
+  - @param ns Namespace where the cluster is deployed
+  - @param cluster Name of the cluster
+  - @param selector Additional label selector of the machines, all the machines if empty
+  - @returns The node names of the machines or an error
+*/
+func GetClusterNodes(k Client, ns, cluster, selector string) ([]string, error) {
+	s := "cluster.x-k8s.io/cluster-name=" + cluster
+	if selector != "" {
+		s += "," + selector
+	}
+
+	list := &MachineList{}
+	if err := k.List(KindMachine, ns, s, list); err != nil {
+		return nil, err
+	}
+
+	nodes := []string{}
+	for _, m := range list.Items {
+		if m.Status.NodeRef != nil {
+			nodes = append(nodes, m.Status.NodeRef.Name)
+		}
+	}
+
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: node matching %s", ErrNotFound, s)
+	}
+
+	return nodes, nil
+}
+
+/*
+Get the nodes of the control plane of a CAPI cluster
+  - @param k Kubernetes client
+  - @param ns Namespace where the cluster is deployed
+  - @param cluster Name of the cluster
+  - @returns The node names of the control plane machines or an error
+*/
+func GetControlPlaneNodes(k Client, ns, cluster string) ([]string, error) {
+	return GetClusterNodes(k, ns, cluster, "cluster.x-k8s.io/control-plane=")
 }
 
 /*
 Get nodeName from MachineInventory
+  - @param k Kubernetes client
   - @param ns Namespace
   - @param machine Machine name as seen by Rancher Manager
   - @returns Corresponding external machine name
 */
-func GetExternalMachine(ns, machine string) (string, error) {
-	node, err := kubectl.RunWithoutErr("get", "Machine",
-		"--namespace", ns, machine,
-		"-o", "jsonpath={.status.addresses[?(@.type==\"Hostname\")].address}")
-	if err != nil {
-		return "", err
-	}
-
-	return node, nil
+func GetExternalMachine(k Client, ns, machine string) (string, error) {
+	return getMachineAddress(k, ns, machine, "Hostname")
 }
 
 /*
 Get IP from MachineInventory
+  - @param k Kubernetes client
   - @param ns Namespace
   - @param machine Machine name as seen by Rancher Manager
   - @returns Corresponding machine IP
 */
-func GetExternalMachineIP(ns, machine string) (string, error) {
-	node, err := kubectl.RunWithoutErr("get", "Machine",
-		"--namespace", ns, machine,
-		"-o", "jsonpath={.status.addresses[?(@.type==\"InternalIP\")].address}")
-	if err != nil {
-		return "", err
-	}
-
-	return node, nil
+func GetExternalMachineIP(k Client, ns, machine string) (string, error) {
+	return getMachineAddress(k, ns, machine, "InternalIP")
 }
 
 /*
 Get container URI from ManagedOSVersion
+  - @param k Kubernetes client
   - @param ns Namespace
   - @param os OS version to get URI from
   - @returns URI of container image
 */
-func GetImageURI(ns, os string) (string, error) {
-	uri, err := kubectl.RunWithoutErr("get", "ManagedOSVersion",
-		"--namespace", ns, os,
-		"-o", "jsonpath={.spec.metadata.uri}")
-
-	if err != nil {
+func GetImageURI(k Client, ns, os string) (string, error) {
+	v := &ManagedOSVersion{}
+	if err := k.Get(KindManagedOSVersion, ns, os, v); err != nil {
 		return "", err
 	}
 
-	return uri, nil
+	if v.Spec.Metadata.URI == "" {
+		return "", fmt.Errorf("%w: spec.metadata.uri in ManagedOSVersion %s", ErrFieldMissing, os)
+	}
+
+	return v.Spec.Metadata.URI, nil
 }
 
 /*
 Get Machine from MachineInventory
+  - @param k Kubernetes client
   - @param ns Namespace
   - @param machineInventory Machine name as seen by Elemental
-  - @returns Corresponding internal machine name
+  - @returns Corresponding internal machine or an error
 */
-func GetInternalMachine(ns, machineInventory string) (string, error) {
-	machine, err := kubectl.RunWithoutErr("get", "Machine",
-		"--namespace", ns,
-		"-o", "jsonpath={.items[?(@.status.nodeRef.name==\""+machineInventory+"\")].metadata.name}")
-	if err != nil {
-		return "", err
+func GetInternalMachine(k Client, ns, machineInventory string) (*Machine, error) {
+	list := &MachineList{}
+	if err := k.List(KindMachine, ns, "", list); err != nil {
+		return nil, err
 	}
 
-	return machine, nil
+	for i := range list.Items {
+		if ref := list.Items[i].Status.NodeRef; ref != nil && ref.Name == machineInventory {
+			return &list.Items[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: Machine with node %s", ErrNotFound, machineInventory)
 }
 
 /*
 Get container image used for Elemental operator
+  - @param k Kubernetes client
   - @returns The container image used or an error
 */
-func GetOperatorImage() (string, error) {
-	operatorImage, err := kubectl.RunWithoutErr("get", "pod",
-		"--namespace", "cattle-elemental-system",
-		"-l", "app=elemental-operator", "-o", "jsonpath={.items[*].status.containerStatuses[*].image}")
-	if err != nil {
+func GetOperatorImage(k Client) (string, error) {
+	list := &PodList{}
+	if err := k.List(KindPod, "cattle-elemental-system", "app=elemental-operator", list); err != nil {
 		return "", err
 	}
 
-	return operatorImage, nil
+	for _, p := range list.Items {
+		for _, c := range p.Status.ContainerStatuses {
+			if c.Image != "" {
+				return c.Image, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("%w: elemental-operator pod", ErrNotFound)
 }
 
 /*
 Get Elemental operator version
+  - @param k Kubernetes client
   - @returns the Elemental operator version or an error
 */
-func GetOperatorVersion() (string, error) {
-	operatorImage, err := GetOperatorImage()
+func GetOperatorVersion(k Client) (string, error) {
+	operatorImage, err := GetOperatorImage(k)
 	if err != nil {
 		return "", err
 	}
@@ -167,30 +283,58 @@ func GetOperatorVersion() (string, error) {
 
 /*
 Get MachineInventory name (aka. server id)
+  - @param k Kubernetes client
   - @param ns Namespace
-  - @param index URL of the repository
+  - @param index Index of the MachineInventory, starting at 1
   - @returns The name/id of the server or an error
 */
-func GetServerID(ns string, index int) (string, error) {
-	serverID, err := kubectl.RunWithoutErr("get", "MachineInventories",
-		"--namespace", ns,
-		"-o", "jsonpath={.items["+fmt.Sprint(index-1)+"].metadata.name}")
-	if err != nil {
+func GetServerID(k Client, ns string, index int) (string, error) {
+	list := &MachineInventoryList{}
+	if err := k.List(KindMachineInventory, ns, "", list); err != nil {
 		return "", err
 	}
 
-	return serverID, nil
+	if index < 1 || index > len(list.Items) {
+		return "", fmt.Errorf("%w: MachineInventory #%d (%d found)", ErrNotFound, index, len(list.Items))
+	}
+
+	return list.Items[index-1].Metadata.Name, nil
+}
+
+/*
+Get the TPM hash registered for a host
+  - @param k Kubernetes client
+  - @param kind Kind of the resource (KindMachineInventory or KindElementalHost)
+  - @param ns Namespace
+  - @param name Name of the resource
+  - @returns The TPM hash or an error
+*/
+func GetTPMHash(k Client, kind, ns, name string) (string, error) {
+	h := &struct {
+		Spec struct {
+			TPMHash string `json:"tpmHash,omitempty"`
+		} `json:"spec"`
+	}{}
+	if err := k.Get(kind, ns, name, h); err != nil {
+		return "", err
+	}
+
+	if h.Spec.TPMHash == "" {
+		return "", fmt.Errorf("%w: TPM hash in %s %s", ErrFieldMissing, kind, name)
+	}
+
+	return h.Spec.TPMHash, nil
 }
 
 /*
 Set hostname of the node
   - @param baseName Basename to use, "empty" if nothing provided
-  - @param index index of the node
-  - @returns Full hostname of the node
+  - @param index index of the node, negative values are replaced by 0
+  - @returns Full hostname of the node, baseName followed by the index on at least 3 digits
 */
 func SetHostname(baseName string, index int) string {
 	if baseName == "" {
-		baseName = "emtpy"
+		baseName = "empty"
 	}
 
 	if index < 0 {
@@ -200,21 +344,93 @@ func SetHostname(baseName string, index int) string {
 	return baseName + "-" + fmt.Sprintf("%03d", index)
 }
 
+/*
+Set the API server address in a kubeconfig
+  - @param kubeconfig Kubeconfig to modify
+  - @param host Address of the API server, the port of the original server is kept
+  - @returns The modified kubeconfig or an error
+*/
+func SetKubeconfigServer(kubeconfig []byte, host string) ([]byte, error) {
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(kubeconfig, &config); err != nil {
+		return nil, err
+	}
+
+	clusters, _ := config["clusters"].([]interface{})
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("%w: clusters in kubeconfig", ErrFieldMissing)
+	}
+
+	for _, c := range clusters {
+		entry, ok := c.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: cluster in kubeconfig", ErrFieldMissing)
+		}
+		cluster, _ := entry["cluster"].(map[string]interface{})
+		server, _ := cluster["server"].(string)
+		if server == "" {
+			return nil, fmt.Errorf("%w: server in kubeconfig", ErrFieldMissing)
+		}
+
+		u, err := url.Parse(server)
+		if err != nil {
+			return nil, err
+		}
+		port := u.Port()
+		if port == "" {
+			port = "6443"
+		}
+		u.Host = net.JoinHostPort(host, port)
+		cluster["server"] = u.String()
+	}
+
+	return yaml.Marshal(config)
+}
+
 /*
 Set a label on MachineInventory
+  - @param k Kubernetes client
   - @param ns Name of the repository
   - @param node Name of the node
   - @param key Label to set
   - @param value Value to set on Label
   - @returns Nothing or an error
 */
-func SetMachineInventoryLabel(ns, node, key, value string) error {
-	_, err := kubectl.RunWithoutErr("label", "machineinventory",
-		"--namespace", ns, node,
-		"--overwrite", key+"="+value)
-	if err != nil {
-		return err
+func SetMachineInventoryLabel(k Client, ns, node, key, value string) error {
+	return k.Label(KindMachineInventory, ns, node, key, value)
+}
+
+/*
+Get a deterministic emulated TPM seed for a node
+  - @param hostName Hostname of the node
+  - @returns The seed, always positive as -1 means random
+*/
+func TPMSeed(hostName string) int64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(hostName))
+
+	return int64(h.Sum32())
+}
+
+/*
+Get an address of a Machine
+  - @param k Kubernetes client
+  - @param ns Namespace
+  - @param machine Machine name
+  - @param addrType Type of the address (Hostname, InternalIP, ...)
+  - @returns The address or an error
+*/
+func getMachineAddress(k Client, ns, machine, addrType string) (string, error) {
+	m := &Machine{}
+	if err := k.Get(KindMachine, ns, machine, m); err != nil {
+		return "", err
+	}
+
+	for _, a := range m.Status.Addresses {
+		if a.Type == addrType {
+			return a.Address, nil
+		}
 	}
 
-	return nil
+	return "", fmt.Errorf("%w: %s address in Machine %s", ErrFieldMissing, addrType, machine)
 }
@@ -0,0 +1,54 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+func FuzzSetHostname(f *testing.F) {
+	f.Add("node", 1)
+	f.Add("", 0)
+	f.Add("node-", -1)
+	f.Add("node", 99999)
+
+	f.Fuzz(func(t *testing.T, base string, index int) {
+		h := elemental.SetHostname(base, index)
+
+		if base == "" {
+			base = "empty"
+		}
+		if !strings.HasPrefix(h, base+"-") {
+			t.Fatalf("%q does not start with %q", h, base+"-")
+		}
+
+		// The index can always be read back
+		suffix := strings.TrimPrefix(h, base+"-")
+		if len(suffix) < 3 {
+			t.Fatalf("index of %q is not padded to 3 digits", h)
+		}
+		n, err := strconv.Atoi(suffix)
+		if err != nil {
+			t.Fatalf("index of %q is not a number: %v", h, err)
+		}
+		if n != max(index, 0) {
+			t.Fatalf("index of %q is %d instead of %d", h, n, max(index, 0))
+		}
+	})
+}
@@ -0,0 +1,346 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+const ns = "fleet-default"
+
+func machine(name, node string, addrs map[string]string) *elemental.Machine {
+	m := &elemental.Machine{Metadata: elemental.ObjectMeta{Name: name, Namespace: ns}}
+	if node != "" {
+		m.Status.NodeRef = &elemental.ObjectReference{Kind: "Node", Name: node}
+	}
+	for t, a := range addrs {
+		m.Status.Addresses = append(m.Status.Addresses, elemental.MachineAddress{Type: t, Address: a})
+	}
+
+	return m
+}
+
+var _ = Describe("Elemental helpers", func() {
+	var k *elemental.Fake
+
+	BeforeEach(func() {
+		k = elemental.NewFake()
+	})
+
+	Describe("AddSelectorToTemplate", func() {
+		const template = `apiVersion: elemental.cattle.io/v1beta1
+kind: MachineInventorySelectorTemplate
+metadata:
+  name: selector-master-cluster-k3s
+spec:
+  template:
+    spec:
+      selector: {}
+`
+
+		It("adds the labels to match", func() {
+			out, err := elemental.AddSelectorToTemplate([]byte(template), "cluster-name", "cluster-k3s")
+			Expect(err).To(Not(HaveOccurred()))
+			out, err = elemental.AddSelectorToTemplate(out, "role", "master")
+			Expect(err).To(Not(HaveOccurred()))
+
+			Expect(string(out)).To(MatchYAML(`apiVersion: elemental.cattle.io/v1beta1
+kind: MachineInventorySelectorTemplate
+metadata:
+  name: selector-master-cluster-k3s
+spec:
+  template:
+    spec:
+      selector:
+        matchLabels:
+          cluster-name: cluster-k3s
+          role: master
+`))
+		})
+	})
+
+	Describe("GetClusterState", func() {
+		BeforeEach(func() {
+			c := &elemental.ProvisioningCluster{Metadata: elemental.ObjectMeta{Name: "cluster-k3s"}}
+			c.Status.Conditions = []elemental.Condition{{Type: "Ready", Status: "True"}}
+			Expect(k.Add(elemental.KindProvisioningCluster, ns, c)).To(Succeed())
+		})
+
+		It("returns the status of the condition", func() {
+			Expect(elemental.GetClusterState(k, ns, "cluster-k3s", "Ready")).To(Equal("True"))
+		})
+
+		It("distinguishes a missing condition from a missing cluster", func() {
+			_, err := elemental.GetClusterState(k, ns, "cluster-k3s", "Updated")
+			Expect(err).To(MatchError(elemental.ErrFieldMissing))
+
+			_, err = elemental.GetClusterState(k, ns, "cluster-rke2", "Ready")
+			Expect(err).To(MatchError(elemental.ErrNotFound))
+		})
+	})
+
+	Describe("GetExternalMachine", func() {
+		BeforeEach(func() {
+			Expect(k.Add(elemental.KindMachine, ns, machine("m-1", "node-001",
+				map[string]string{"Hostname": "node-001", "InternalIP": "192.168.122.2"}))).To(Succeed())
+			Expect(k.Add(elemental.KindMachine, ns, machine("m-2", "", nil))).To(Succeed())
+		})
+
+		It("returns the addresses", func() {
+			Expect(elemental.GetExternalMachine(k, ns, "m-1")).To(Equal("node-001"))
+			Expect(elemental.GetExternalMachineIP(k, ns, "m-1")).To(Equal("192.168.122.2"))
+		})
+
+		It("fails if the address is not set yet", func() {
+			_, err := elemental.GetExternalMachineIP(k, ns, "m-2")
+			Expect(err).To(MatchError(elemental.ErrFieldMissing))
+		})
+
+		It("fails if the machine does not exist", func() {
+			_, err := elemental.GetExternalMachine(k, ns, "m-3")
+			Expect(err).To(MatchError(elemental.ErrNotFound))
+		})
+	})
+
+	Describe("GetClusterKubeconfig", func() {
+		It("returns the decoded kubeconfig", func() {
+			s := &elemental.Secret{Metadata: elemental.ObjectMeta{Name: "cluster-k3s-kubeconfig"}}
+			s.Data = map[string][]byte{"value": []byte("apiVersion: v1\nkind: Config\n")}
+			Expect(k.Add(elemental.KindSecret, ns, s)).To(Succeed())
+			Expect(k.Add(elemental.KindSecret, ns, &elemental.Secret{Metadata: elemental.ObjectMeta{Name: "cluster-rke2-kubeconfig"}})).To(Succeed())
+
+			Expect(elemental.GetClusterKubeconfig(k, ns, "cluster-k3s")).To(Equal([]byte("apiVersion: v1\nkind: Config\n")))
+
+			_, err := elemental.GetClusterKubeconfig(k, ns, "cluster-rke2")
+			Expect(err).To(MatchError(elemental.ErrFieldMissing))
+
+			_, err = elemental.GetClusterKubeconfig(k, ns, "cluster-other")
+			Expect(err).To(MatchError(elemental.ErrNotFound))
+		})
+	})
+
+	Describe("GetControlPlaneNodes", func() {
+		It("returns the nodes of the control plane machines of the cluster", func() {
+			for _, m := range []struct {
+				name, cluster, node string
+				controlPlane        bool
+			}{
+				{"cp-1", "cluster-k3s", "node-001", true},
+				{"cp-2", "cluster-k3s", "", true},
+				{"worker-1", "cluster-k3s", "node-002", false},
+				{"cp-3", "cluster-rke2", "node-003", true},
+			} {
+				mc := machine(m.name, m.node, nil)
+				mc.Metadata.Labels = map[string]string{"cluster.x-k8s.io/cluster-name": m.cluster}
+				if m.controlPlane {
+					mc.Metadata.Labels["cluster.x-k8s.io/control-plane"] = ""
+				}
+				Expect(k.Add(elemental.KindMachine, ns, mc)).To(Succeed())
+			}
+
+			Expect(elemental.GetControlPlaneNodes(k, ns, "cluster-k3s")).To(Equal([]string{"node-001"}))
+
+			_, err := elemental.GetControlPlaneNodes(k, ns, "cluster-other")
+			Expect(err).To(MatchError(elemental.ErrNotFound))
+		})
+	})
+
+	Describe("GetClusterNodes", func() {
+		It("returns the nodes of all the machines of the cluster", func() {
+			for _, m := range []struct {
+				name, cluster, node string
+			}{
+				{"cp-1", "cluster-k3s", "node-001"},
+				{"worker-1", "cluster-k3s", "node-002"},
+				{"worker-2", "cluster-k3s", ""},
+				{"cp-2", "cluster-rke2", "node-003"},
+			} {
+				mc := machine(m.name, m.node, nil)
+				mc.Metadata.Labels = map[string]string{"cluster.x-k8s.io/cluster-name": m.cluster}
+				Expect(k.Add(elemental.KindMachine, ns, mc)).To(Succeed())
+			}
+
+			Expect(elemental.GetClusterNodes(k, ns, "cluster-k3s", "")).To(Equal([]string{"node-001", "node-002"}))
+
+			// Workers are the machines without the control plane label
+			Expect(k.Label(elemental.KindMachine, ns, "cp-1", "cluster.x-k8s.io/control-plane", "")).To(Succeed())
+			Expect(elemental.GetClusterNodes(k, ns, "cluster-k3s", "!cluster.x-k8s.io/control-plane")).To(Equal([]string{"node-002"}))
+
+			_, err := elemental.GetClusterNodes(k, ns, "cluster-other", "")
+			Expect(err).To(MatchError(elemental.ErrNotFound))
+		})
+	})
+
+	Describe("GetInternalMachine", func() {
+		It("returns the machine linked to the node", func() {
+			Expect(k.Add(elemental.KindMachine, ns, machine("m-1", "node-001", nil))).To(Succeed())
+			Expect(k.Add(elemental.KindMachine, ns, machine("m-2", "node-002", nil))).To(Succeed())
+
+			m, err := elemental.GetInternalMachine(k, ns, "node-002")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(m.Metadata.Name).To(Equal("m-2"))
+
+			_, err = elemental.GetInternalMachine(k, ns, "node-003")
+			Expect(err).To(MatchError(elemental.ErrNotFound))
+		})
+	})
+
+	Describe("GetImageURI", func() {
+		It("returns the URI of the ManagedOSVersion", func() {
+			v := &elemental.ManagedOSVersion{Metadata: elemental.ObjectMeta{Name: "v2.1.0"}}
+			v.Spec.Metadata.URI = "registry.example.com/elemental-os:v2.1.0"
+			Expect(k.Add(elemental.KindManagedOSVersion, ns, v)).To(Succeed())
+			Expect(k.Add(elemental.KindManagedOSVersion, ns,
+				&elemental.ManagedOSVersion{Metadata: elemental.ObjectMeta{Name: "v2.2.0"}})).To(Succeed())
+
+			Expect(elemental.GetImageURI(k, ns, "v2.1.0")).To(Equal("registry.example.com/elemental-os:v2.1.0"))
+
+			_, err := elemental.GetImageURI(k, ns, "v2.2.0")
+			Expect(err).To(MatchError(elemental.ErrFieldMissing))
+		})
+	})
+
+	Describe("GetOperatorVersion", func() {
+		It("extracts the version from the operator image", func() {
+			p := &elemental.Pod{Metadata: elemental.ObjectMeta{
+				Name:   "elemental-operator-abc",
+				Labels: map[string]string{"app": "elemental-operator"},
+			}}
+			p.Status.ContainerStatuses = []elemental.ContainerStatus{{Name: "operator", Image: "registry.example.com/elemental-operator:1.6.0"}}
+			Expect(k.Add(elemental.KindPod, "cattle-elemental-system", p)).To(Succeed())
+
+			Expect(elemental.GetOperatorVersion(k)).To(Equal("1.6.0"))
+		})
+
+		It("fails without operator pod", func() {
+			p := &elemental.Pod{Metadata: elemental.ObjectMeta{Name: "other", Labels: map[string]string{"app": "other"}}}
+			Expect(k.Add(elemental.KindPod, "cattle-elemental-system", p)).To(Succeed())
+
+			_, err := elemental.GetOperatorVersion(k)
+			Expect(err).To(MatchError(elemental.ErrNotFound))
+		})
+	})
+
+	Describe("GetServerID and SetMachineInventoryLabel", func() {
+		BeforeEach(func() {
+			for _, n := range []string{"mi-b", "mi-a"} {
+				mi := &elemental.MachineInventory{Metadata: elemental.ObjectMeta{Name: n}}
+				Expect(k.Add(elemental.KindMachineInventory, ns, mi)).To(Succeed())
+			}
+		})
+
+		It("returns the inventories by index", func() {
+			Expect(elemental.GetServerID(k, ns, 1)).To(Equal("mi-a"))
+			Expect(elemental.GetServerID(k, ns, 2)).To(Equal("mi-b"))
+
+			for _, i := range []int{0, 3} {
+				_, err := elemental.GetServerID(k, ns, i)
+				Expect(err).To(MatchError(elemental.ErrNotFound))
+			}
+		})
+
+		It("sets a label", func() {
+			Expect(elemental.SetMachineInventoryLabel(k, ns, "mi-a", "role", "worker")).To(Succeed())
+
+			mi := &elemental.MachineInventory{}
+			Expect(k.Get(elemental.KindMachineInventory, ns, "mi-a", mi)).To(Succeed())
+			Expect(mi.Metadata.Labels).To(HaveKeyWithValue("role", "worker"))
+
+			err := elemental.SetMachineInventoryLabel(k, ns, "mi-c", "role", "worker")
+			Expect(err).To(MatchError(elemental.ErrNotFound))
+		})
+	})
+
+	Describe("GetTPMHash", func() {
+		It("returns the hash of the inventory", func() {
+			mi := &elemental.MachineInventory{Metadata: elemental.ObjectMeta{Name: "mi-a"}}
+			mi.Spec.TPMHash = "4fa2c3"
+			Expect(k.Add(elemental.KindMachineInventory, ns, mi)).To(Succeed())
+			Expect(k.Add(elemental.KindMachineInventory, ns, &elemental.MachineInventory{Metadata: elemental.ObjectMeta{Name: "mi-b"}})).To(Succeed())
+
+			Expect(elemental.GetTPMHash(k, elemental.KindMachineInventory, ns, "mi-a")).To(Equal("4fa2c3"))
+
+			_, err := elemental.GetTPMHash(k, elemental.KindMachineInventory, ns, "mi-b")
+			Expect(err).To(MatchError(elemental.ErrFieldMissing))
+
+			_, err = elemental.GetTPMHash(k, elemental.KindElementalHost, ns, "mi-a")
+			Expect(err).To(MatchError(elemental.ErrNotFound))
+		})
+	})
+
+	Describe("TPMSeed", func() {
+		It("returns a deterministic and positive seed per node", func() {
+			seeds := map[int64]bool{}
+			for i := 1; i <= 20; i++ {
+				s := elemental.TPMSeed(elemental.SetHostname("node", i))
+				Expect(s).To(BeNumerically(">=", 0))
+				Expect(seeds).To(Not(HaveKey(s)))
+				seeds[s] = true
+			}
+
+			Expect(elemental.TPMSeed("node-001")).To(Equal(elemental.TPMSeed("node-001")))
+		})
+	})
+
+	Describe("SetKubeconfigServer", func() {
+		kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: cluster-k3s
+  cluster:
+    certificate-authority-data: Q0EK
+    server: https://192.168.122.50:6443
+users:
+- name: cluster-k3s-admin
+  user:
+    token: secret
+`
+
+		It("replaces the host and keeps the port", func() {
+			out, err := elemental.SetKubeconfigServer([]byte(kubeconfig), "192.168.122.102")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(string(out)).To(ContainSubstring("server: https://192.168.122.102:6443"))
+			Expect(string(out)).To(ContainSubstring("certificate-authority-data: Q0EK"))
+			Expect(string(out)).To(ContainSubstring("token: secret"))
+		})
+
+		It("rejects kubeconfig without server", func() {
+			_, err := elemental.SetKubeconfigServer([]byte("apiVersion: v1\nkind: Config\n"), "192.168.122.102")
+			Expect(err).To(MatchError(elemental.ErrFieldMissing))
+		})
+
+		It("rejects malformed cluster entries", func() {
+			_, err := elemental.SetKubeconfigServer([]byte("clusters:\n- cluster-k3s\n"), "192.168.122.102")
+			Expect(err).To(MatchError(elemental.ErrFieldMissing))
+
+			_, err = elemental.SetKubeconfigServer([]byte("clusters:\n- name: cluster-k3s\n  cluster: https://192.168.122.50:6443\n"), "192.168.122.102")
+			Expect(err).To(MatchError(elemental.ErrFieldMissing))
+		})
+	})
+
+	Describe("SetHostname", func() {
+		DescribeTable("builds the hostname",
+			func(base string, index int, expected string) {
+				Expect(elemental.SetHostname(base, index)).To(Equal(expected))
+			},
+			Entry("first node", "node", 1, "node-001"),
+			Entry("large index", "node", 1234, "node-1234"),
+			Entry("negative index", "node", -5, "node-000"),
+			Entry("empty basename", "", 7, "empty-007"),
+		)
+	})
+})
@@ -0,0 +1,173 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Fake is an in-memory Client, to be used in unit tests
+type Fake struct {
+	// Objects stored as decoded JSON, indexed by kind, namespace and name
+	objects map[string]map[string]interface{}
+	mutex   sync.Mutex
+}
+
+/*
+Create a fake client
+  - @returns Pointer to the Fake structure
+*/
+func NewFake() *Fake {
+	return &Fake{objects: make(map[string]map[string]interface{})}
+}
+
+/*
+Add a resource, the name and labels are taken from its metadata
+  - @param kind Kind of the resource
+  - @param ns Namespace of the resource
+  - @param obj Resource to add, it has to be JSON encodable
+  - @returns Nothing or an error
+*/
+func (f *Fake) Add(kind, ns string, obj interface{}) error {
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	var o map[string]interface{}
+	if err := json.Unmarshal(out, &o); err != nil {
+		return err
+	}
+
+	meta, _ := o["metadata"].(map[string]interface{})
+	name, _ := meta["name"].(string)
+	if name == "" {
+		return fmt.Errorf("%w: metadata.name", ErrFieldMissing)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.objects[kind] == nil {
+		f.objects[kind] = make(map[string]interface{})
+	}
+	f.objects[kind][ns+"/"+name] = o
+
+	return nil
+}
+
+// Get decodes the stored resource into obj
+func (f *Fake) Get(kind, ns, name string, obj interface{}) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	o, ok := f.objects[kind][ns+"/"+name]
+	if !ok {
+		return fmt.Errorf("%w: %s %s/%s", ErrNotFound, kind, ns, name)
+	}
+
+	return convert(o, obj)
+}
+
+// List decodes the stored resources, sorted by name like the API server does
+func (f *Fake) List(kind, ns, selector string, list interface{}) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	keys := make([]string, 0, len(f.objects[kind]))
+	for k := range f.objects[kind] {
+		if strings.HasPrefix(k, ns+"/") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	items := []interface{}{}
+	for _, k := range keys {
+		o := f.objects[kind][k]
+		if matchSelector(o, selector) {
+			items = append(items, o)
+		}
+	}
+
+	return convert(map[string]interface{}{"items": items}, list)
+}
+
+// Label sets a label in the metadata of the stored resource
+func (f *Fake) Label(kind, ns, name, key, value string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	o, ok := f.objects[kind][ns+"/"+name].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: %s %s/%s", ErrNotFound, kind, ns, name)
+	}
+
+	meta := o["metadata"].(map[string]interface{})
+	labels, _ := meta["labels"].(map[string]interface{})
+	if labels == nil {
+		labels = make(map[string]interface{})
+		meta["labels"] = labels
+	}
+	labels[key] = value
+
+	return nil
+}
+
+// convert re-encodes a decoded JSON value into obj
+func convert(in, obj interface{}) error {
+	out, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(out, obj)
+}
+
+/*
+Check if a resource matches a label selector
+  - @param obj Resource as decoded JSON
+  - @param selector Comma separated list of key=value or !key, only equality and absence are supported
+  - @returns True if all the labels match
+*/
+func matchSelector(obj interface{}, selector string) bool {
+	if selector == "" {
+		return true
+	}
+
+	o, _ := obj.(map[string]interface{})
+	meta, _ := o["metadata"].(map[string]interface{})
+	labels, _ := meta["labels"].(map[string]interface{})
+
+	for _, s := range strings.Split(selector, ",") {
+		if key, ok := strings.CutPrefix(s, "!"); ok {
+			if _, found := labels[key]; found {
+				return false
+			}
+			continue
+		}
+
+		key, value, _ := strings.Cut(s, "=")
+		if v, ok := labels[key].(string); !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
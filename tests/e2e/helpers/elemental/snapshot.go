@@ -0,0 +1,106 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrResourceLost is returned when a resource of a snapshot does not exist anymore
+	ErrResourceLost = errors.New("resource lost")
+
+	// ErrResourceRecreated is returned when a resource of a snapshot has a new UID
+	ErrResourceRecreated = errors.New("resource re-created")
+)
+
+// Snapshot contains the UIDs of resources, indexed by kind and name
+type Snapshot map[string]map[string]string
+
+/*
+Take a snapshot of resources
+  - @param k Kubernetes client
+  - @param ns Namespace of the resources
+  - @param kinds Kinds of the resources to snapshot
+  - @returns The snapshot or an error
+*/
+func TakeSnapshot(k Client, ns string, kinds ...string) (Snapshot, error) {
+	list := &struct {
+		Items []struct {
+			Metadata ObjectMeta `json:"metadata"`
+		} `json:"items"`
+	}{}
+
+	s := Snapshot{}
+	for _, kind := range kinds {
+		list.Items = nil
+		if err := k.List(kind, ns, "", list); err != nil {
+			return nil, err
+		}
+
+		s[kind] = make(map[string]string, len(list.Items))
+		for _, i := range list.Items {
+			s[kind][i.Metadata.Name] = i.Metadata.UID
+		}
+	}
+
+	return s, nil
+}
+
+/*
+Get the names of the resources of a kind
+  - @param kind Kind of the resources
+  - @returns The sorted names of the resources
+*/
+func (s Snapshot) Names(kind string) []string {
+	names := make([]string, 0, len(s[kind]))
+	for n := range s[kind] {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+/*
+Check that all the resources of the snapshot are still the same
+NOTE: new resources are allowed
+  - @param after Snapshot taken later with the same kinds
+  - @returns Nothing or an error listing all the lost and re-created resources
+*/
+func (s Snapshot) Compare(after Snapshot) error {
+	kinds := make([]string, 0, len(s))
+	for kind := range s {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var errs []error
+	for _, kind := range kinds {
+		for _, name := range s.Names(kind) {
+			uid, ok := after[kind][name]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("%w: %s %s", ErrResourceLost, kind, name))
+			case uid != s[kind][name]:
+				errs = append(errs, fmt.Errorf("%w: %s %s (UID %s, was %s)", ErrResourceRecreated, kind, name, uid, s[kind][name]))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
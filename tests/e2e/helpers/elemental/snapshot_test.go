@@ -0,0 +1,72 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+var _ = Describe("Snapshot", func() {
+	var k *elemental.Fake
+
+	add := func(name, uid string) {
+		mi := &elemental.MachineInventory{Metadata: elemental.ObjectMeta{Name: name, UID: uid}}
+		Expect(k.Add(elemental.KindMachineInventory, ns, mi)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		k = elemental.NewFake()
+		add("mi-b", "uid-b")
+		add("mi-a", "uid-a")
+	})
+
+	It("records the UIDs of the resources", func() {
+		s, err := elemental.TakeSnapshot(k, ns, elemental.KindMachineInventory, elemental.KindMachineRegistration)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(s).To(Equal(elemental.Snapshot{
+			elemental.KindMachineInventory:    {"mi-a": "uid-a", "mi-b": "uid-b"},
+			elemental.KindMachineRegistration: {},
+		}))
+		Expect(s.Names(elemental.KindMachineInventory)).To(Equal([]string{"mi-a", "mi-b"}))
+	})
+
+	It("accepts new resources", func() {
+		before, err := elemental.TakeSnapshot(k, ns, elemental.KindMachineInventory)
+		Expect(err).To(Not(HaveOccurred()))
+
+		add("mi-c", "uid-c")
+		after, err := elemental.TakeSnapshot(k, ns, elemental.KindMachineInventory)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(before.Compare(after)).To(Succeed())
+	})
+
+	It("reports lost and re-created resources", func() {
+		before := elemental.Snapshot{elemental.KindMachineInventory: {"mi-a": "uid-a", "mi-b": "uid-b", "mi-c": "uid-c"}}
+
+		// Re-create mi-a with a new UID, and lose mi-c
+		add("mi-a", "uid-new")
+		after, err := elemental.TakeSnapshot(k, ns, elemental.KindMachineInventory)
+		Expect(err).To(Not(HaveOccurred()))
+
+		err = before.Compare(after)
+		Expect(err).To(MatchError(elemental.ErrResourceLost))
+		Expect(err).To(MatchError(elemental.ErrResourceRecreated))
+		Expect(err).To(MatchError(ContainSubstring("mi-a (UID uid-new, was uid-a)")))
+		Expect(err).To(MatchError(ContainSubstring("mi-c")))
+		Expect(err).To(Not(MatchError(ContainSubstring("mi-b"))))
+	})
+})
@@ -0,0 +1,189 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elemental
+
+// ObjectMeta contains the metadata fields used by the helpers
+type ObjectMeta struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	UID       string            `json:"uid,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Condition is a standard Kubernetes condition
+type Condition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ObjectReference points to another resource
+type ObjectReference struct {
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// MachineAddress is an address of a CAPI Machine
+type MachineAddress struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// Machine is a CAPI Machine
+type Machine struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		ClusterName       string          `json:"clusterName,omitempty"`
+		InfrastructureRef ObjectReference `json:"infrastructureRef"`
+		ProviderID        string          `json:"providerID,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		NodeRef   *ObjectReference `json:"nodeRef,omitempty"`
+		Addresses []MachineAddress `json:"addresses,omitempty"`
+		Phase     string           `json:"phase,omitempty"`
+	} `json:"status"`
+}
+
+// MachineList is a list of CAPI Machines
+type MachineList struct {
+	Items []Machine `json:"items"`
+}
+
+// ElementalHost is an Elemental CAPI host, available or associated to a machine
+type ElementalHost struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		TPMHash string `json:"tpmHash,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []Condition `json:"conditions,omitempty"`
+	} `json:"status"`
+}
+
+// ElementalHostList is a list of Elemental CAPI hosts
+type ElementalHostList struct {
+	Items []ElementalHost `json:"items"`
+}
+
+// ElementalMachine is an Elemental CAPI infrastructure machine
+type ElementalMachine struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		ProviderID string `json:"providerID,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []Condition `json:"conditions,omitempty"`
+	} `json:"status"`
+}
+
+// ElementalMachineList is a list of Elemental CAPI infrastructure machines
+type ElementalMachineList struct {
+	Items []ElementalMachine `json:"items"`
+}
+
+// MachineInventory is an Elemental MachineInventory
+type MachineInventory struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		TPMHash string `json:"tpmHash,omitempty"`
+	} `json:"spec"`
+}
+
+// MachineInventoryList is a list of Elemental MachineInventories
+type MachineInventoryList struct {
+	Items []MachineInventory `json:"items"`
+}
+
+// ManagedOSVersion is an Elemental ManagedOSVersion
+type ManagedOSVersion struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Version  string `json:"version,omitempty"`
+		Metadata struct {
+			URI string `json:"uri,omitempty"`
+		} `json:"metadata"`
+	} `json:"spec"`
+}
+
+// Node is a Kubernetes Node
+type Node struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		ProviderID string `json:"providerID,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []Condition `json:"conditions,omitempty"`
+		NodeInfo   struct {
+			KubeletVersion string `json:"kubeletVersion,omitempty"`
+		} `json:"nodeInfo"`
+	} `json:"status"`
+}
+
+// NodeList is a list of Kubernetes Nodes
+type NodeList struct {
+	Items []Node `json:"items"`
+}
+
+// ProvisioningCluster is a Rancher provisioning Cluster
+type ProvisioningCluster struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Status   struct {
+		Ready      bool        `json:"ready,omitempty"`
+		Conditions []Condition `json:"conditions,omitempty"`
+	} `json:"status"`
+}
+
+// ContainerStatus is the status of a container in a Pod
+type ContainerStatus struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+	Ready bool   `json:"ready"`
+}
+
+// Pod is a Kubernetes Pod
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Status   struct {
+		Phase             string            `json:"phase,omitempty"`
+		ContainerStatuses []ContainerStatus `json:"containerStatuses,omitempty"`
+	} `json:"status"`
+}
+
+// PodList is a list of Kubernetes Pods
+type PodList struct {
+	Items []Pod `json:"items"`
+}
+
+// Secret is a Kubernetes Secret, data are base64 decoded
+type Secret struct {
+	Metadata ObjectMeta        `json:"metadata"`
+	Data     map[string][]byte `json:"data,omitempty"`
+}
+
+// Kinds used with the Client
+const (
+	KindElementalHost       = "elementalhosts.infrastructure.cluster.x-k8s.io"
+	KindElementalMachine    = "elementalmachines.infrastructure.cluster.x-k8s.io"
+	KindMachine             = "machines.cluster.x-k8s.io"
+	KindMachineInventory    = "machineinventories.elemental.cattle.io"
+	KindMachineRegistration = "machineregistrations.elemental.cattle.io"
+	KindManagedOSVersion    = "managedosversions.elemental.cattle.io"
+	KindNode                = "node"
+	KindPod                 = "pod"
+	KindProvisioningCluster = "clusters.provisioning.cattle.io"
+	KindSecret              = "secret"
+)
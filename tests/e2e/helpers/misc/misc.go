@@ -16,45 +16,94 @@ package misc
 
 import (
 	"math/rand"
+	"sync"
 	"time"
 )
 
+// Maximum duration of RandomSleep
+const randomSleepMax = 4 * time.Minute
+
+// Sleeper waits for random durations
+// NOTE: the random source and the clock can be replaced, mainly for unit tests
+type Sleeper struct {
+	// Base maximum duration of a wait
+	Max time.Duration
+	// Random source, seeded with the current time if nil
+	Rand *rand.Rand
+	// Function used to wait, time.Sleep if nil
+	Sleep func(time.Duration)
+
+	mutex sync.Mutex
+}
+
+// Used by RandomSleep
+var defaultSleeper = NewSleeper(randomSleepMax)
+
 /*
-Wait for random time
-  - @param index Modulo for the seed
-  - @returns Wait for the calculated time
+Create a sleeper using the real clock
+  - @param maxWait Base maximum duration of a wait
+  - @returns Pointer to the Sleeper structure
 */
-func RandomSleep(sequential bool, index int) {
-	// Only useful in parallel mode
-	if sequential {
-		return
+func NewSleeper(maxWait time.Duration) *Sleeper {
+	return &Sleeper{
+		Max:   maxWait,
+		Rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		Sleep: time.Sleep,
 	}
+}
 
-	// Initialize the seed
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+/*
+Get a random duration, with a millisecond precision
+  - @param index Index of the node, used to spread the upper bound between nodes
+  - @returns A duration in [0, Max + (Max % index)) for a positive index, in [0, Max) otherwise, 0 if Max is lower than 1ms
+*/
+func (s *Sleeper) Duration(index int) time.Duration {
+	limit := s.Max.Milliseconds()
+	if index > 0 {
+		limit += limit % int64(index)
+	}
+	if limit <= 0 {
+		return 0
+	}
 
-	// Get a pseudo-random value
-	timeMax := 240000
-	value := r.Intn(timeMax + (timeMax % index))
+	// rand.Rand cannot be used concurrently
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Rand == nil {
+		s.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
 
-	// Wait until value is reached
-	time.Sleep(time.Duration(value) * time.Millisecond)
+	return time.Duration(s.Rand.Int63n(limit)) * time.Millisecond
 }
 
 /*
-Wait for nodes to be booted
-  - @param index Index of the current VM (usually used in a loop)
-  - @param vmIndex Index of the first booted node
-  - @param bootedNodes Number of already booted nodes
-  - @param maxNodes Maximum number of nodes
-  - @returns Returns (increment) the number of already booted nodes
+Wait for random time
+  - @param sequential Nodes are started one by one, so there is no need to wait
+  - @param index Index of the node, see Duration
+  - @returns The waited duration
 */
-func WaitNodesBoot(index, vmIndex, bootedNodes, maxNodes int) int {
-	if (index - vmIndex - bootedNodes) == maxNodes {
-		// Wait a little
-		time.Sleep(4 * time.Minute)
+func (s *Sleeper) RandomSleep(sequential bool, index int) time.Duration {
+	// Only useful in parallel mode
+	if sequential {
+		return 0
+	}
+
+	d := s.Duration(index)
+	sleep := s.Sleep
+	if sleep == nil {
+		sleep = time.Sleep
 	}
+	sleep(d)
 
-	// Save the number of nodes already bootstrapped for the next round
-	return (index - vmIndex)
+	return d
+}
+
+/*
+Wait for random time, up to 4 minutes
+  - @param sequential Nodes are started one by one, so there is no need to wait
+  - @param index Index of the node, any value is accepted
+  - @returns Wait for the calculated time
+*/
+func RandomSleep(sequential bool, index int) {
+	_ = defaultSleeper.RandomSleep(sequential, index)
 }
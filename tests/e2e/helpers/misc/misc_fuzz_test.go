@@ -0,0 +1,85 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package misc_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/misc"
+)
+
+// constSource is a random source always returning the same value
+type constSource int64
+
+func (c constSource) Int63() int64 { return int64(c) }
+func (c constSource) Seed(int64)   {}
+
+func FuzzDuration(f *testing.F) {
+	f.Add(int64(4*time.Minute), 0, int64(1))
+	f.Add(int64(time.Second), -3, int64(2))
+	f.Add(int64(0), 5, int64(3))
+	f.Add(int64(-time.Second), 1, int64(4))
+
+	f.Fuzz(func(t *testing.T, maxWait int64, index int, seed int64) {
+		newSleeper := func(maxWait time.Duration) *misc.Sleeper {
+			s := misc.NewSleeper(maxWait)
+			s.Rand = rand.New(rand.NewSource(seed))
+			return s
+		}
+
+		d := newSleeper(time.Duration(maxWait)).Duration(index)
+		if d < 0 {
+			t.Fatalf("negative duration %s", d)
+		}
+
+		// Millisecond precision, the duration is printed and parsed back without loss
+		if d%time.Millisecond != 0 {
+			t.Fatalf("duration %s is not a number of milliseconds", d)
+		}
+		if p, err := time.ParseDuration(d.String()); err != nil || p != d {
+			t.Fatalf("duration %s parsed as %s (%v)", d, p, err)
+		}
+
+		// Nothing to wait for below one millisecond
+		if time.Duration(maxWait) < time.Millisecond && d != 0 {
+			t.Fatalf("duration %s for a maximum of %s", d, time.Duration(maxWait))
+		}
+
+		// The index can at most double the maximum
+		if d > 0 && (d/2 >= time.Duration(maxWait) || (index <= 0 && d >= time.Duration(maxWait))) {
+			t.Fatalf("duration %s too long for a maximum of %s and index %d", d, time.Duration(maxWait), index)
+		}
+
+		// Same random source, same duration
+		if again := newSleeper(time.Duration(maxWait)).Duration(index); again != d {
+			t.Fatalf("duration %s then %s with the same seed", d, again)
+		}
+
+		// Raising the maximum never shortens a wait drawn from the same random value
+		v := time.Duration(uint16(seed)) * time.Millisecond
+		if v < time.Duration(maxWait) && maxWait < math.MaxInt64/2 {
+			for _, m := range []time.Duration{time.Duration(maxWait), 2 * time.Duration(maxWait)} {
+				s := misc.NewSleeper(m)
+				s.Rand = rand.New(constSource(v.Milliseconds()))
+				if got := s.Duration(index); got != v {
+					t.Fatalf("duration %s instead of %s for a maximum of %s", got, v, m)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package misc_test
+
+import (
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/misc"
+)
+
+// newSleeper returns a sleeper with a fixed seed, recording the waits instead of sleeping
+func newSleeper(maxWait time.Duration, waits *[]time.Duration) *misc.Sleeper {
+	s := misc.NewSleeper(maxWait)
+	s.Rand = rand.New(rand.NewSource(42))
+	s.Sleep = func(d time.Duration) { *waits = append(*waits, d) }
+
+	return s
+}
+
+var _ = Describe("Sleeper", func() {
+	var waits []time.Duration
+
+	BeforeEach(func() {
+		waits = nil
+	})
+
+	It("does not wait in sequential mode", func() {
+		s := newSleeper(time.Minute, &waits)
+		Expect(s.RandomSleep(true, 3)).To(BeZero())
+		Expect(waits).To(BeEmpty())
+	})
+
+	It("accepts any index", func() {
+		s := newSleeper(time.Minute, &waits)
+		for _, i := range []int{-10, -1, 0, 1, 7, 1000000} {
+			d := s.RandomSleep(false, i)
+			Expect(d).To(BeNumerically(">=", 0))
+			Expect(d).To(BeNumerically("<", 2*time.Minute))
+		}
+		Expect(waits).To(HaveLen(6))
+	})
+
+	It("waits for the drawn duration", func() {
+		s := newSleeper(time.Minute, &waits)
+		d := s.RandomSleep(false, 0)
+		Expect(waits).To(Equal([]time.Duration{d}))
+		Expect(d % time.Millisecond).To(BeZero())
+	})
+
+	It("is reproducible with the same seed", func() {
+		var other []time.Duration
+		s1, s2 := newSleeper(time.Minute, &waits), newSleeper(time.Minute, &other)
+		for i := 0; i < 5; i++ {
+			Expect(s1.Duration(i)).To(Equal(s2.Duration(i)))
+		}
+	})
+
+	It("does not wait without maximum", func() {
+		s := newSleeper(0, &waits)
+		Expect(s.RandomSleep(false, 3)).To(BeZero())
+		Expect(waits).To(Equal([]time.Duration{0}))
+	})
+})
@@ -15,16 +15,24 @@ limitations under the License.
 package network
 
 import (
+	"strings"
+
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
 )
 
+// Config file downloaded by each node when per-node configs are used,
+// expanded by iPXE with the MAC address of the booting interface
+const nodeConfigPattern = "install-config-$${mac:hexhyp}.yaml"
+
 /*
 Configure iPXE server for OS provisioning
+  - @param dir Directory where the .ipxe files are searched
   - @param httpSrv IP address:port where the files are shared
+  - @param perNode Use a config file per node instead of a shared one, see NodeConfigFile
   - @returns The number of .ipxe files found or an error
 */
-func ConfigureiPXE(httpSrv string) (int, error) {
-	ipxeScript, err := tools.GetFilesList("../..", "install.ipxe")
+func ConfigureiPXE(dir, httpSrv string, perNode bool) (int, error) {
+	ipxeScript, err := tools.GetFilesList(dir, "install.ipxe")
 	if err != nil {
 		return 0, err
 	}
@@ -36,7 +44,12 @@ func ConfigureiPXE(httpSrv string) (int, error) {
 			return 0, err
 		}
 
-		err = tools.Sed(".*set config.*", "set config $${url}/install-config.yaml", ipxeScript[0])
+		config := "install-config.yaml"
+		if perNode {
+			config = nodeConfigPattern
+		}
+
+		err = tools.Sed(".*set config.*", "set config $${url}/"+config, ipxeScript[0])
 		if err != nil {
 			return 0, err
 		}
@@ -45,3 +58,12 @@ func ConfigureiPXE(httpSrv string) (int, error) {
 	// Returns the number of ipxe files found
 	return len(ipxeScript), nil
 }
+
+/*
+Get the name of the config file downloaded by a node when iPXE uses per-node configs
+  - @param mac MAC address of the node
+  - @returns Name of the config file, as expanded by iPXE
+*/
+func NodeConfigFile(mac string) string {
+	return "install-config-" + strings.ToLower(strings.ReplaceAll(mac, ":", "-")) + ".yaml"
+}
@@ -0,0 +1,252 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioning
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/v2/reporters"
+)
+
+// Phase of the node provisioning
+type Phase string
+
+// List of phases, in the order they are reached
+const (
+	PhaseNetworkAdded Phase = "NetworkEntryAdded"
+	PhaseVMCreated    Phase = "VMCreated"
+	PhaseInstalled    Phase = "InstallSuccessful"
+	PhaseShutOff      Phase = "ShutOff"
+	PhaseRestarted    Phase = "Restarted"
+	PhaseSSHUp        Phase = "SSHUp"
+	PhaseHostReady    Phase = "ElementalHostReady"
+)
+
+// Phases lists all the phases in order
+var Phases = []Phase{
+	PhaseNetworkAdded,
+	PhaseVMCreated,
+	PhaseInstalled,
+	PhaseShutOff,
+	PhaseRestarted,
+	PhaseSSHUp,
+	PhaseHostReady,
+}
+
+// Event is a phase reached at a given time
+type Event struct {
+	Phase Phase     `json:"phase"`
+	Time  time.Time `json:"time"`
+}
+
+// Failure of a node provisioning
+type Failure struct {
+	Phase   Phase  `json:"phase"`
+	Message string `json:"message"`
+}
+
+// Node provisioning record
+type Node struct {
+	Name    string   `json:"name"`
+	Events  []Event  `json:"events"`
+	Failure *Failure `json:"failure,omitempty"`
+}
+
+// Report of the provisioning of all the nodes
+// NOTE: it is safe to use it from different goroutines
+type Report struct {
+	Start time.Time        `json:"start"`
+	Nodes map[string]*Node `json:"nodes"`
+	mutex sync.Mutex
+}
+
+/*
+Create a provisioning report
+  - @returns Pointer to the Report structure
+*/
+func NewReport() *Report {
+	return &Report{
+		Start: time.Now(),
+		Nodes: make(map[string]*Node),
+	}
+}
+
+/*
+Record that a node has reached a phase
+  - @param name Node name
+  - @param p Phase reached
+*/
+func (r *Report) Record(name string, p Phase) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.node(name).Events = append(r.node(name).Events, Event{Phase: p, Time: time.Now()})
+}
+
+/*
+Mark the nodes that did not reach the last phase as failed
+  - @param last Last phase expected to be reached
+  - @param msg Failure message
+*/
+func (r *Report) MarkFailures(last Phase, msg string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, n := range r.Nodes {
+		if n.Failure != nil || n.reached(last) {
+			continue
+		}
+		n.Failure = &Failure{Phase: n.nextPhase(), Message: msg}
+	}
+}
+
+/*
+Write the report in JSON format
+  - @param file File to write
+  - @returns Nothing or an error
+*/
+func (r *Report) WriteJSON(file string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, out, 0644)
+}
+
+/*
+Write the report in JUnit format, with one test case per node
+  - @param file File to write
+  - @returns Nothing or an error
+*/
+func (r *Report) WriteJUnit(file string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	suite := reporters.JUnitTestSuite{
+		Name:      "Nodes provisioning",
+		Timestamp: r.Start.Format(time.RFC3339),
+		Time:      time.Since(r.Start).Seconds(),
+	}
+
+	for _, n := range r.sortedNodes() {
+		tc := reporters.JUnitTestCase{
+			Name:      n.Name,
+			Classname: suite.Name,
+			Status:    "passed",
+			Time:      n.duration().Seconds(),
+			SystemOut: n.timeline(),
+		}
+		if n.Failure != nil {
+			tc.Status = "failed"
+			tc.Failure = &reporters.JUnitFailure{
+				Message:     fmt.Sprintf("%s not reached", n.Failure.Phase),
+				Type:        "failed",
+				Description: n.Failure.Message,
+			}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+		suite.Tests++
+	}
+
+	suites := reporters.JUnitTestSuites{
+		Tests:      suite.Tests,
+		Failures:   suite.Failures,
+		Time:       suite.Time,
+		TestSuites: []reporters.JUnitTestSuite{suite},
+	}
+
+	out, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, append([]byte(xml.Header), out...), 0644)
+}
+
+// node returns the node record, created if needed (mutex must be held)
+func (r *Report) node(name string) *Node {
+	n, ok := r.Nodes[name]
+	if !ok {
+		n = &Node{Name: name}
+		r.Nodes[name] = n
+	}
+
+	return n
+}
+
+// sortedNodes returns the nodes sorted by name (mutex must be held)
+func (r *Report) sortedNodes() []*Node {
+	nodes := make([]*Node, 0, len(r.Nodes))
+	for _, n := range r.Nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	return nodes
+}
+
+// reached returns true if the phase has been reached
+func (n *Node) reached(p Phase) bool {
+	for _, e := range n.Events {
+		if e.Phase == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nextPhase returns the first phase not reached
+func (n *Node) nextPhase() Phase {
+	for _, p := range Phases {
+		if !n.reached(p) {
+			return p
+		}
+	}
+
+	return Phases[len(Phases)-1]
+}
+
+// duration returns the time between the first and the last events
+func (n *Node) duration() time.Duration {
+	if len(n.Events) == 0 {
+		return 0
+	}
+
+	return n.Events[len(n.Events)-1].Time.Sub(n.Events[0].Time)
+}
+
+// timeline returns the phases with the time elapsed since the first event
+func (n *Node) timeline() string {
+	var b strings.Builder
+
+	for _, e := range n.Events {
+		fmt.Fprintf(&b, "%s: %s (+%s)\n", e.Phase, e.Time.Format(time.RFC3339), e.Time.Sub(n.Events[0].Time).Round(time.Second))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioning_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/ginkgo/v2/reporters"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/provisioning"
+)
+
+var _ = Describe("Provisioning report", func() {
+	var r *provisioning.Report
+
+	BeforeEach(func() {
+		r = provisioning.NewReport()
+		for _, p := range provisioning.Phases {
+			r.Record("node-001", p)
+		}
+		r.Record("node-002", provisioning.PhaseNetworkAdded)
+		r.Record("node-002", provisioning.PhaseVMCreated)
+		r.Record("node-003", provisioning.PhaseNetworkAdded)
+	})
+
+	It("marks the nodes not reaching the last phase as failed", func() {
+		r.MarkFailures(provisioning.PhaseShutOff, "timeout")
+
+		Expect(r.Nodes["node-001"].Failure).To(BeNil())
+		// Failure is set on the first phase not reached
+		Expect(r.Nodes["node-002"].Failure).To(Equal(&provisioning.Failure{Phase: provisioning.PhaseInstalled, Message: "timeout"}))
+		Expect(r.Nodes["node-003"].Failure).To(Equal(&provisioning.Failure{Phase: provisioning.PhaseVMCreated, Message: "timeout"}))
+	})
+
+	It("keeps the first failure of a node", func() {
+		r.MarkFailures(provisioning.PhaseShutOff, "first")
+		r.Record("node-002", provisioning.PhaseInstalled)
+		r.MarkFailures(provisioning.PhaseHostReady, "second")
+
+		Expect(r.Nodes["node-002"].Failure.Message).To(Equal("first"))
+		Expect(r.Nodes["node-002"].Failure.Phase).To(Equal(provisioning.PhaseInstalled))
+	})
+
+	It("uses the first phase not reached, even if later phases are reached", func() {
+		r.Record("node-004", provisioning.PhaseHostReady)
+		r.MarkFailures(provisioning.PhaseSSHUp, "not reached")
+
+		Expect(r.Nodes["node-004"].Failure.Phase).To(Equal(provisioning.PhaseNetworkAdded))
+	})
+
+	It("writes the report in JSON format", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "report.json")
+		Expect(r.WriteJSON(file)).To(Succeed())
+
+		data, err := os.ReadFile(file)
+		Expect(err).To(Not(HaveOccurred()))
+
+		read := &provisioning.Report{}
+		Expect(json.Unmarshal(data, read)).To(Succeed())
+		Expect(read.Nodes).To(HaveLen(3))
+		Expect(read.Nodes["node-001"].Events).To(HaveLen(len(provisioning.Phases)))
+	})
+
+	It("writes the report in JUnit format with one test case per node", func() {
+		r.MarkFailures(provisioning.PhaseShutOff, "timeout")
+
+		file := filepath.Join(GinkgoT().TempDir(), "report.xml")
+		Expect(r.WriteJUnit(file)).To(Succeed())
+
+		data, err := os.ReadFile(file)
+		Expect(err).To(Not(HaveOccurred()))
+
+		suites := &reporters.JUnitTestSuites{}
+		Expect(xml.Unmarshal(data, suites)).To(Succeed())
+		Expect(suites.Tests).To(Equal(3))
+		Expect(suites.Failures).To(Equal(2))
+		Expect(suites.TestSuites).To(HaveLen(1))
+
+		suite := suites.TestSuites[0]
+		ts, err := time.Parse(time.RFC3339, suite.Timestamp)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(ts).To(BeTemporally("~", r.Start, time.Second))
+
+		// Test cases are sorted by node name
+		Expect(suite.TestCases).To(HaveLen(3))
+		Expect(suite.TestCases[0].Name).To(Equal("node-001"))
+		Expect(suite.TestCases[0].Status).To(Equal("passed"))
+		Expect(suite.TestCases[0].Failure).To(BeNil())
+		Expect(suite.TestCases[0].SystemOut).To(ContainSubstring(string(provisioning.PhaseHostReady)))
+		Expect(suite.TestCases[2].Name).To(Equal("node-003"))
+		Expect(suite.TestCases[2].Status).To(Equal("failed"))
+		Expect(suite.TestCases[2].Failure.Message).To(Equal("VMCreated not reached"))
+		Expect(suite.TestCases[2].Failure.Description).To(Equal("timeout"))
+	})
+})
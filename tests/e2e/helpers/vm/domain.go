@@ -0,0 +1,277 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vm
+
+import (
+	"path/filepath"
+	"strings"
+
+	"libvirt.org/go/libvirtxml"
+)
+
+/*
+Generate libvirt domain XML
+  - @param o VM options
+  - @returns The domain XML or an error
+*/
+func DomainXML(o *Options) (string, error) {
+	if err := o.Validate(); err != nil {
+		return "", err
+	}
+
+	d := &libvirtxml.Domain{
+		Type: "kvm",
+		Name: o.Name,
+		Memory: &libvirtxml.DomainMemory{
+			Value: uint(o.Memory),
+			Unit:  "MiB",
+		},
+		VCPU: &libvirtxml.DomainVCPU{
+			Value: uint(o.CPU),
+		},
+		OS: &libvirtxml.DomainOS{
+			Type: &libvirtxml.DomainOSType{
+				Arch:    "x86_64",
+				Machine: "q35",
+				Type:    "hvm",
+			},
+		},
+		Features: &libvirtxml.DomainFeatureList{
+			ACPI: &libvirtxml.DomainFeature{},
+			APIC: &libvirtxml.DomainFeatureAPIC{},
+		},
+		CPU: &libvirtxml.DomainCPU{
+			Mode: "host-model",
+		},
+		OnPoweroff: "destroy",
+		OnReboot:   onReboot(o),
+		OnCrash:    "destroy",
+		Devices: &libvirtxml.DomainDeviceList{
+			Interfaces: []libvirtxml.DomainInterface{networkInterface(o)},
+			Serials: []libvirtxml.DomainSerial{
+				{
+					Source: &libvirtxml.DomainChardevSource{Pty: &libvirtxml.DomainChardevSourcePty{}},
+					Log:    consoleLog(o),
+				},
+			},
+			Consoles: []libvirtxml.DomainConsole{
+				{
+					Source: &libvirtxml.DomainChardevSource{Pty: &libvirtxml.DomainChardevSourcePty{}},
+					Target: &libvirtxml.DomainConsoleTarget{Type: "virtio"},
+				},
+			},
+			RNGs: []libvirtxml.DomainRNG{
+				{
+					Model: "virtio",
+					Backend: &libvirtxml.DomainRNGBackend{
+						Random: &libvirtxml.DomainRNGBackendRandom{Device: "/dev/urandom"},
+					},
+				},
+			},
+		},
+	}
+
+	// Memory backing
+	if o.Hugepages {
+		d.MemoryBacking = &libvirtxml.DomainMemoryBacking{
+			MemoryHugePages: &libvirtxml.DomainMemoryHugepages{
+				Hugepages: []libvirtxml.DomainMemoryHugepage{{Size: 2, Unit: "M"}},
+			},
+			MemoryLocked: &libvirtxml.DomainMemoryLocked{},
+		}
+	}
+
+	// Firmware
+	if f := o.Firmware; f != nil {
+		d.OS.Loader = &libvirtxml.DomainLoader{
+			Path:     f.Code,
+			Readonly: "yes",
+			Type:     "pflash",
+		}
+		d.OS.NVRam = &libvirtxml.DomainNVRam{
+			Template: f.VarsTemplate,
+		}
+		if f.SecureBoot {
+			d.OS.Loader.Secure = "yes"
+			d.Features.SMM = &libvirtxml.DomainFeatureSMM{State: "on"}
+		}
+	}
+
+	// TPM
+	if o.TPM {
+		d.Devices.TPMs = []libvirtxml.DomainTPM{
+			{
+				Model: "tpm-crb",
+				Backend: &libvirtxml.DomainTPMBackend{
+					Emulator: &libvirtxml.DomainTPMBackendEmulator{Version: "2.0"},
+				},
+			},
+		}
+	}
+
+	// Disks
+	d.Devices.Disks = disks(o)
+	if diskBus(o) == "scsi" {
+		d.Devices.Controllers = []libvirtxml.DomainController{
+			{
+				Type:  "scsi",
+				Model: "virtio-scsi",
+			},
+		}
+	}
+
+	return d.Marshal()
+}
+
+/*
+Generate libvirt snapshot XML, each disk is saved in a qcow2 overlay next to it
+  - @param domain Domain XML of the VM, as known by libvirt
+  - @param snapshot Name of the snapshot
+  - @returns The snapshot XML or an error
+*/
+func SnapshotXML(domain, snapshot string) (string, error) {
+	d := &libvirtxml.Domain{}
+	if err := d.Unmarshal(domain); err != nil {
+		return "", err
+	}
+
+	s := &libvirtxml.DomainSnapshot{
+		Name:  snapshot,
+		Disks: &libvirtxml.DomainSnapshotDisks{},
+	}
+	if d.Devices == nil {
+		return s.Marshal()
+	}
+
+	for _, disk := range d.Devices.Disks {
+		if disk.Target == nil {
+			continue
+		}
+
+		// Installation media are not modified
+		sd := libvirtxml.DomainSnapshotDisk{Name: disk.Target.Dev, Snapshot: "no"}
+		if disk.Device == "disk" && disk.Source != nil && disk.Source.File != nil {
+			file := disk.Source.File.File
+			sd.Snapshot = "external"
+			sd.Driver = &libvirtxml.DomainDiskDriver{Type: "qcow2"}
+			sd.Source = &libvirtxml.DomainDiskSource{
+				File: &libvirtxml.DomainDiskSourceFile{
+					File: strings.TrimSuffix(file, filepath.Ext(file)) + "-" + snapshot + ".qcow2",
+				},
+			}
+		}
+		s.Disks.Disks = append(s.Disks.Disks, sd)
+	}
+
+	return s.Marshal()
+}
+
+// diskBus returns the bus to use for the disk
+func diskBus(o *Options) string {
+	if o.DiskBus == "" {
+		return "scsi"
+	}
+
+	return o.DiskBus
+}
+
+/*
+Generate disks list
+  - @param o VM options
+  - @returns The list of disks to attach to the domain
+*/
+func disks(o *Options) []libvirtxml.DomainDisk {
+	// Disk is always the first boot device, an empty disk is simply skipped
+	// by the firmware, so the installation media will be used
+	list := []libvirtxml.DomainDisk{
+		{
+			Device: "disk",
+			Driver: &libvirtxml.DomainDiskDriver{Name: "qemu", Type: diskFormat(o)},
+			Source: &libvirtxml.DomainDiskSource{
+				File: &libvirtxml.DomainDiskSourceFile{File: o.Disk},
+			},
+			Target: &libvirtxml.DomainDiskTarget{Dev: "sda", Bus: diskBus(o)},
+			Boot:   &libvirtxml.DomainDeviceBoot{Order: 1},
+		},
+	}
+
+	if o.BootType == BootISO {
+		list = append(list, libvirtxml.DomainDisk{
+			Device: "cdrom",
+			Driver: &libvirtxml.DomainDiskDriver{Name: "qemu", Type: "raw"},
+			Source: &libvirtxml.DomainDiskSource{
+				File: &libvirtxml.DomainDiskSourceFile{File: o.Media},
+			},
+			Target:   &libvirtxml.DomainDiskTarget{Dev: "sdb", Bus: "sata"},
+			ReadOnly: &libvirtxml.DomainDiskReadOnly{},
+			Boot:     &libvirtxml.DomainDeviceBoot{Order: 2},
+		})
+	}
+
+	return list
+}
+
+// diskFormat returns the format of the disk image
+func diskFormat(o *Options) string {
+	if o.BootType == BootImport {
+		return "qcow2"
+	}
+
+	return "raw"
+}
+
+// networkInterface returns the network interface of the domain
+func networkInterface(o *Options) libvirtxml.DomainInterface {
+	network := o.Network
+	if network == "" {
+		network = "default"
+	}
+
+	i := libvirtxml.DomainInterface{
+		Source: &libvirtxml.DomainInterfaceSource{
+			Network: &libvirtxml.DomainInterfaceSourceNetwork{Network: network},
+		},
+		Model: &libvirtxml.DomainInterfaceModel{Type: "virtio"},
+	}
+
+	if o.MAC != "" {
+		i.MAC = &libvirtxml.DomainInterfaceMAC{Address: o.MAC}
+	}
+
+	// Network boot is used only if the disk is not bootable
+	if o.BootType == BootPXE {
+		i.Boot = &libvirtxml.DomainDeviceBoot{Order: 2}
+	}
+
+	return i
+}
+
+// onReboot returns the action to do when the VM reboots
+func onReboot(o *Options) string {
+	if o.NoReboot {
+		return "destroy"
+	}
+
+	return "restart"
+}
+
+// consoleLog returns the log configuration of the serial console
+func consoleLog(o *Options) *libvirtxml.DomainChardevLog {
+	if o.ConsoleLogFile == "" {
+		return nil
+	}
+
+	return &libvirtxml.DomainChardevLog{File: o.ConsoleLogFile, Append: "on"}
+}
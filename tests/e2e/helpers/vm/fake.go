@@ -0,0 +1,150 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FakeVM is the in-memory representation of a VM
+type FakeVM struct {
+	Options   Options
+	State     State
+	Console   string
+	Snapshots []string
+}
+
+// Fake is an in-memory Hypervisor, to be used in unit tests
+type Fake struct {
+	VMs   map[string]*FakeVM
+	mutex sync.Mutex
+}
+
+/*
+Create a fake hypervisor
+  - @returns Pointer to the Fake structure
+*/
+func NewFake() *Fake {
+	return &Fake{VMs: make(map[string]*FakeVM)}
+}
+
+// Define validates the options and adds the VM in shut off state
+func (f *Fake) Define(o *Options) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.VMs[o.Name]; ok {
+		return fmt.Errorf("VM %s already defined", o.Name)
+	}
+	f.VMs[o.Name] = &FakeVM{Options: *o, State: StateShutOff}
+
+	return nil
+}
+
+// Start moves a shut off VM to running state
+func (f *Fake) Start(name string) error {
+	return f.transition(name, StateShutOff, StateRunning)
+}
+
+// Shutdown moves a running VM to shut off state
+func (f *Fake) Shutdown(name string) error {
+	return f.transition(name, StateRunning, StateShutOff)
+}
+
+// Destroy moves a running VM to shut off state
+func (f *Fake) Destroy(name string) error {
+	return f.transition(name, StateRunning, StateShutOff)
+}
+
+// State returns the state of the VM
+func (f *Fake) State(name string) (State, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	v, ok := f.VMs[name]
+	if !ok {
+		return StateUndefined, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	return v.State, nil
+}
+
+// ConsoleLog returns the console content set in the FakeVM
+func (f *Fake) ConsoleLog(name string) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	v, ok := f.VMs[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	return v.Console, nil
+}
+
+// XML returns the domain XML generated from the VM options
+func (f *Fake) XML(name string) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	v, ok := f.VMs[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	return DomainXML(&v.Options)
+}
+
+// Snapshot records the snapshot name
+func (f *Fake) Snapshot(name, snapshot string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	v, ok := f.VMs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	v.Snapshots = append(v.Snapshots, snapshot)
+
+	return nil
+}
+
+/*
+Change the state of a VM
+  - @param name Name of the VM
+  - @param from Expected current state
+  - @param to New state
+  - @returns Nothing or an error, like libvirt does if the VM is not in the expected state
+*/
+func (f *Fake) transition(name string, from, to State) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	v, ok := f.VMs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if v.State != from {
+		return fmt.Errorf("VM %s is %s instead of %s", name, v.State, from)
+	}
+	v.State = to
+
+	return nil
+}
@@ -0,0 +1,431 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"libvirt.org/go/libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+// SystemURI is the URI of the libvirt system instance, where the VMs are created
+const SystemURI = "qemu:///system"
+
+// states maps the libvirt domain states to the virsh ones
+var states = map[libvirt.DomainState]State{
+	libvirt.DOMAIN_BLOCKED:     StateIdle,
+	libvirt.DOMAIN_CRASHED:     StateCrashed,
+	libvirt.DOMAIN_NOSTATE:     StateNoState,
+	libvirt.DOMAIN_PAUSED:      StatePaused,
+	libvirt.DOMAIN_PMSUSPENDED: StatePMSuspended,
+	libvirt.DOMAIN_RUNNING:     StateRunning,
+	libvirt.DOMAIN_SHUTDOWN:    StateShutdown,
+	libvirt.DOMAIN_SHUTOFF:     StateShutOff,
+}
+
+// domain is the part of the libvirt domain API used by Libvirt
+type domain interface {
+	Create() error
+	CreateSnapshot(xml string, flags libvirt.DomainSnapshotCreateFlags) error
+	Destroy() error
+	Free() error
+	GetState() (libvirt.DomainState, int, error)
+	GetXMLDesc(flags libvirt.DomainXMLFlags) (string, error)
+	Shutdown() error
+}
+
+// connection is the part of the libvirt connection API used by Libvirt
+type connection interface {
+	Close() (int, error)
+	DomainDefineXML(xml string) (domain, error)
+	LookupDomainByName(name string) (domain, error)
+}
+
+// libvirtConnection returns the domains as interfaces
+type libvirtConnection struct {
+	*libvirt.Connect
+}
+
+func (c libvirtConnection) DomainDefineXML(xml string) (domain, error) {
+	d, err := c.Connect.DomainDefineXML(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	return libvirtDomain{d}, nil
+}
+
+func (c libvirtConnection) LookupDomainByName(name string) (domain, error) {
+	d, err := c.Connect.LookupDomainByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return libvirtDomain{d}, nil
+}
+
+// libvirtDomain frees the snapshots it creates
+type libvirtDomain struct {
+	*libvirt.Domain
+}
+
+func (d libvirtDomain) CreateSnapshot(xml string, flags libvirt.DomainSnapshotCreateFlags) error {
+	s, err := d.Domain.CreateSnapshotXML(xml, flags)
+	if err != nil {
+		return err
+	}
+
+	return s.Free()
+}
+
+// Libvirt is a Hypervisor using the libvirt API
+type Libvirt struct {
+	conn connection
+	// Log files of the serial consoles
+	consoleLogs map[string]string
+	// Definitions to use once the installation is started, see Options.NoReboot
+	finalXMLs map[string]string
+	mutex     sync.Mutex
+}
+
+/*
+Create a libvirt hypervisor
+NOTE: the user needs access to the libvirt instance, through the libvirt group for example
+  - @param uri URI of the libvirt instance, usually SystemURI
+  - @returns Pointer to the Libvirt structure or an error
+*/
+func NewLibvirt(uri string) (*Libvirt, error) {
+	conn, err := libvirt.NewConnect(uri)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %s: %w", uri, err)
+	}
+
+	return newLibvirt(libvirtConnection{conn}), nil
+}
+
+// newLibvirt creates a libvirt hypervisor using an existing connection
+func newLibvirt(conn connection) *Libvirt {
+	return &Libvirt{
+		conn:        conn,
+		consoleLogs: make(map[string]string),
+		finalXMLs:   make(map[string]string),
+	}
+}
+
+/*
+Close the connection to libvirt
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Close() error {
+	_, err := l.conn.Close()
+	return err
+}
+
+/*
+Define a VM, the disk is created depending on the boot type
+  - @param o VM options
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Define(o *Options) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	if err := prepareDisk(o); err != nil {
+		return err
+	}
+
+	if err := prepareConsoleLog(o); err != nil {
+		return err
+	}
+
+	xml, err := DomainXML(o)
+	if err != nil {
+		return err
+	}
+
+	// Like virt-install, the VM is defined for the installation and
+	// redefined once started, the running VM keeps the first definition
+	finalXML := ""
+	if o.NoReboot {
+		final := *o
+		final.NoReboot = false
+		if finalXML, err = DomainXML(&final); err != nil {
+			return err
+		}
+	}
+
+	d, err := l.conn.DomainDefineXML(xml)
+	if err != nil {
+		return fmt.Errorf("cannot define %s: %w", o.Name, err)
+	}
+	defer d.Free()
+
+	l.mutex.Lock()
+	l.consoleLogs[o.Name] = o.ConsoleLogFile
+	if finalXML != "" {
+		l.finalXMLs[o.Name] = finalXML
+	}
+	l.mutex.Unlock()
+
+	return nil
+}
+
+/*
+Start a VM
+  - @param name Name of the VM
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Start(name string) error {
+	if err := l.withDomain(name, domain.Create); err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	finalXML, ok := l.finalXMLs[name]
+	delete(l.finalXMLs, name)
+	l.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+
+	d, err := l.conn.DomainDefineXML(finalXML)
+	if err != nil {
+		return fmt.Errorf("cannot redefine %s: %w", name, err)
+	}
+
+	return d.Free()
+}
+
+/*
+Gracefully shutdown a VM
+  - @param name Name of the VM
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Shutdown(name string) error {
+	return l.withDomain(name, domain.Shutdown)
+}
+
+/*
+Forcefully stop a VM
+  - @param name Name of the VM
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Destroy(name string) error {
+	return l.withDomain(name, domain.Destroy)
+}
+
+/*
+Get the state of a VM
+  - @param name Name of the VM
+  - @returns The state of the VM or an error
+*/
+func (l *Libvirt) State(name string) (State, error) {
+	state := StateUndefined
+	err := l.withDomain(name, func(d domain) error {
+		s, _, err := d.GetState()
+		if err != nil {
+			return err
+		}
+		if v, ok := states[s]; ok {
+			state = v
+		}
+		return nil
+	})
+
+	return state, err
+}
+
+/*
+Get the serial console log of a VM
+  - @param name Name of the VM
+  - @returns The content of the console log or an error
+*/
+func (l *Libvirt) ConsoleLog(name string) (string, error) {
+	l.mutex.Lock()
+	file, ok := l.consoleLogs[name]
+	l.mutex.Unlock()
+
+	// VM could have been defined by another process, check its configuration
+	if !ok || file == "" {
+		out, err := l.XML(name)
+		if err != nil {
+			return "", err
+		}
+		file = logFileFromXML(out)
+	}
+	if file == "" {
+		return "", fmt.Errorf("no console log configured for %s", name)
+	}
+
+	// File is created by Define, so it can be read without privileges
+	out, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+/*
+Create an external snapshot of the disks of a VM, running or not
+NOTE: the memory and the firmware variables are not saved, only the disks are
+  - @param name Name of the VM
+  - @param snapshot Name of the snapshot
+  - @returns Nothing or an error
+*/
+func (l *Libvirt) Snapshot(name, snapshot string) error {
+	return l.withDomain(name, func(d domain) error {
+		desc, err := d.GetXMLDesc(0)
+		if err != nil {
+			return err
+		}
+
+		xml, err := SnapshotXML(desc, snapshot)
+		if err != nil {
+			return err
+		}
+
+		// Internal snapshots are not possible with raw disks and pflash firmware
+		return d.CreateSnapshot(xml, libvirt.DOMAIN_SNAPSHOT_CREATE_DISK_ONLY|libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC)
+	})
+}
+
+/*
+Get the domain XML of a VM, as known by libvirt
+  - @param name Name of the VM
+  - @returns The domain XML or an error
+*/
+func (l *Libvirt) XML(name string) (string, error) {
+	var xml string
+	err := l.withDomain(name, func(d domain) error {
+		var err error
+		xml, err = d.GetXMLDesc(0)
+		return err
+	})
+
+	return xml, err
+}
+
+/*
+Execute an action on a VM
+  - @param name Name of the VM
+  - @param action Function to call with the domain of the VM
+  - @returns Nothing or an error, wrapping ErrNotFound if the VM does not exist
+*/
+func (l *Libvirt) withDomain(name string, action func(domain) error) error {
+	d, err := l.conn.LookupDomainByName(name)
+	if err != nil {
+		return wrapError(name, err)
+	}
+	defer d.Free()
+
+	return wrapError(name, action(d))
+}
+
+// wrapError adds the VM name to libvirt errors, and maps the unknown domain error to ErrNotFound
+func wrapError(name string, err error) error {
+	var lerr libvirt.Error
+	if errors.As(err, &lerr) && lerr.Code == libvirt.ERR_NO_DOMAIN {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+/*
+Prepare the disk image of a VM
+  - @param o VM options
+  - @returns Nothing or an error
+*/
+func prepareDisk(o *Options) error {
+	// Nothing to do, the disk already exists
+	if o.BootType == BootImport {
+		_, err := os.Stat(o.Disk)
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(o.Disk), 0755); err != nil {
+		return err
+	}
+
+	size := strconv.Itoa(o.DiskSize) + "G"
+	if o.BootType == BootRaw {
+		// Duplicate the raw image and resize it
+		if out, err := exec.Command("cp", o.Media, o.Disk).CombinedOutput(); err != nil {
+			return fmt.Errorf("cannot copy %s: %w: %s", o.Media, err, out)
+		}
+		if out, err := exec.Command("qemu-img", "resize", "-f", "raw", o.Disk, size).CombinedOutput(); err != nil {
+			return fmt.Errorf("cannot resize %s: %w: %s", o.Disk, err, out)
+		}
+		return nil
+	}
+
+	// Empty disk used as installation target
+	if out, err := exec.Command("qemu-img", "create", "-f", "raw", o.Disk, size).CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot create %s: %w: %s", o.Disk, err, out)
+	}
+
+	return nil
+}
+
+/*
+Create the serial console log file of a VM
+virtlogd only creates the file if it does not exist, readable by root only
+  - @param o VM options
+  - @returns Nothing or an error
+*/
+func prepareConsoleLog(o *Options) error {
+	if o.ConsoleLogFile == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(o.ConsoleLogFile), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(o.ConsoleLogFile, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// logFileFromXML extracts the serial console log file from a domain XML
+func logFileFromXML(domain string) string {
+	d := &libvirtxml.Domain{}
+	if err := d.Unmarshal(domain); err != nil || d.Devices == nil {
+		return ""
+	}
+
+	for _, s := range d.Devices.Serials {
+		if s.Log != nil && s.Log.File != "" {
+			return s.Log.File
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,215 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+// fakeDomain is a domain of fakeConnection
+type fakeDomain struct {
+	xml       string
+	state     libvirt.DomainState
+	snapshots []string
+}
+
+func (d *fakeDomain) Create() error {
+	if d.state == libvirt.DOMAIN_RUNNING {
+		return libvirt.Error{Code: libvirt.ERR_OPERATION_INVALID, Message: "domain is already running"}
+	}
+	d.state = libvirt.DOMAIN_RUNNING
+	return nil
+}
+
+func (d *fakeDomain) CreateSnapshot(xml string, flags libvirt.DomainSnapshotCreateFlags) error {
+	if flags&libvirt.DOMAIN_SNAPSHOT_CREATE_DISK_ONLY == 0 {
+		return libvirt.Error{Code: libvirt.ERR_OPERATION_UNSUPPORTED, Message: "internal snapshots are not supported"}
+	}
+	d.snapshots = append(d.snapshots, xml)
+	return nil
+}
+
+func (d *fakeDomain) Destroy() error {
+	d.state = libvirt.DOMAIN_SHUTOFF
+	return nil
+}
+
+func (d *fakeDomain) Shutdown() error {
+	d.state = libvirt.DOMAIN_SHUTDOWN
+	return nil
+}
+
+func (d *fakeDomain) Free() error { return nil }
+
+func (d *fakeDomain) GetState() (libvirt.DomainState, int, error) { return d.state, 0, nil }
+
+func (d *fakeDomain) GetXMLDesc(libvirt.DomainXMLFlags) (string, error) { return d.xml, nil }
+
+// fakeConnection keeps the defined domains in memory, like the libvirt test driver
+type fakeConnection struct {
+	domains map[string]*fakeDomain
+	defined []string
+}
+
+func (c *fakeConnection) Close() (int, error) { return 0, nil }
+
+func (c *fakeConnection) DomainDefineXML(xml string) (domain, error) {
+	d := &libvirtxml.Domain{}
+	if err := d.Unmarshal(xml); err != nil {
+		return nil, err
+	}
+	c.defined = append(c.defined, xml)
+
+	// Redefining a domain keeps its state
+	if existing, ok := c.domains[d.Name]; ok {
+		existing.xml = xml
+		return existing, nil
+	}
+	c.domains[d.Name] = &fakeDomain{xml: xml, state: libvirt.DOMAIN_SHUTOFF}
+
+	return c.domains[d.Name], nil
+}
+
+func (c *fakeConnection) LookupDomainByName(name string) (domain, error) {
+	d, ok := c.domains[name]
+	if !ok {
+		return nil, libvirt.Error{Code: libvirt.ERR_NO_DOMAIN, Message: "Domain not found"}
+	}
+
+	return d, nil
+}
+
+var _ = Describe("Libvirt hypervisor", func() {
+	var (
+		conn *fakeConnection
+		l    *Libvirt
+		o    *Options
+	)
+
+	BeforeEach(func() {
+		conn = &fakeConnection{domains: map[string]*fakeDomain{}}
+		l = newLibvirt(conn)
+
+		// Existing disk, nothing is created
+		disk := filepath.Join(GinkgoT().TempDir(), "node-001.qcow2")
+		Expect(os.WriteFile(disk, nil, 0o644)).To(Succeed())
+		o = &Options{Name: "node-001", BootType: BootImport, Disk: disk, Memory: 4096, CPU: 4}
+	})
+
+	It("Follows the VM lifecycle", func() {
+		Expect(l.Define(o)).To(Succeed())
+		Expect(l.State("node-001")).To(Equal(StateShutOff))
+
+		Expect(l.Start("node-001")).To(Succeed())
+		Expect(l.State("node-001")).To(Equal(StateRunning))
+		Expect(l.Start("node-001")).To(MatchError(ContainSubstring("domain is already running")))
+
+		Expect(l.Shutdown("node-001")).To(Succeed())
+		Expect(l.State("node-001")).To(Equal(StateShutdown))
+		Expect(l.Destroy("node-001")).To(Succeed())
+		Expect(l.State("node-001")).To(Equal(StateShutOff))
+	})
+
+	It("Maps unknown VMs to ErrNotFound", func() {
+		state, err := l.State("node-002")
+		Expect(err).To(MatchError(ErrNotFound))
+		Expect(state).To(Equal(StateUndefined))
+
+		Expect(l.Start("node-002")).To(MatchError(ErrNotFound))
+		_, err = l.XML("node-002")
+		Expect(err).To(MatchError(ErrNotFound))
+	})
+
+	It("Redefines the VM to reboot normally once the installation is started", func() {
+		o.NoReboot = true
+		Expect(l.Define(o)).To(Succeed())
+		Expect(conn.defined).To(HaveLen(1))
+
+		Expect(l.Start("node-001")).To(Succeed())
+		Expect(conn.defined).To(HaveLen(2))
+
+		d := &libvirtxml.Domain{}
+		Expect(d.Unmarshal(conn.defined[0])).To(Succeed())
+		Expect(d.OnReboot).To(Equal("destroy"))
+		Expect(d.Unmarshal(conn.defined[1])).To(Succeed())
+		Expect(d.OnReboot).To(Equal("restart"))
+
+		// Only done for the first start
+		Expect(l.Destroy("node-001")).To(Succeed())
+		Expect(l.Start("node-001")).To(Succeed())
+		Expect(conn.defined).To(HaveLen(2))
+	})
+
+	It("Reads the console log file from the domain XML", func() {
+		o.ConsoleLogFile = "/var/log/node-001.log"
+		xml, err := DomainXML(o)
+		Expect(err).To(Not(HaveOccurred()))
+
+		Expect(logFileFromXML(xml)).To(Equal("/var/log/node-001.log"))
+		Expect(logFileFromXML("<domain>")).To(BeEmpty())
+	})
+
+	It("Creates the console log file readable by the user", func() {
+		o.ConsoleLogFile = filepath.Join(GinkgoT().TempDir(), "logs", "node-001.log")
+		Expect(l.Define(o)).To(Succeed())
+
+		info, err := os.Stat(o.ConsoleLogFile)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o644)))
+
+		// Written by virtlogd
+		Expect(os.WriteFile(o.ConsoleLogFile, []byte("Welcome to Elemental"), 0o644)).To(Succeed())
+		Expect(l.ConsoleLog("node-001")).To(Equal("Welcome to Elemental"))
+	})
+
+	It("Creates external snapshots of the disks only", func() {
+		// Defined directly, the empty disk would be created by qemu-img
+		o.BootType = BootISO
+		o.Media = "/tmp/elemental.iso"
+		o.Disk = "/tmp/node-001/node-001.img"
+		o.DiskSize = 30
+		xml, err := DomainXML(o)
+		Expect(err).To(Not(HaveOccurred()))
+		_, err = conn.DomainDefineXML(xml)
+		Expect(err).To(Not(HaveOccurred()))
+
+		Expect(l.Snapshot("node-001", "installed")).To(Succeed())
+		Expect(l.Snapshot("node-002", "installed")).To(MatchError(ErrNotFound))
+
+		snapshots := conn.domains["node-001"].snapshots
+		Expect(snapshots).To(HaveLen(1))
+		s := &libvirtxml.DomainSnapshot{}
+		Expect(s.Unmarshal(snapshots[0])).To(Succeed())
+		Expect(s.Name).To(Equal("installed"))
+		Expect(s.Disks.Disks).To(HaveLen(2))
+		Expect(s.Disks.Disks[0].Snapshot).To(Equal("external"))
+		Expect(s.Disks.Disks[0].Source.File.File).To(Equal("/tmp/node-001/node-001-installed.qcow2"))
+		Expect(s.Disks.Disks[1].Snapshot).To(Equal("no"))
+	})
+
+	It("Keeps errors other than unknown VMs", func() {
+		err := wrapError("node-001", errors.New("connection lost"))
+		Expect(err).To(MatchError(ContainSubstring("node-001: connection lost")))
+		Expect(err).To(Not(MatchError(ErrNotFound)))
+		Expect(wrapError("node-001", nil)).To(Succeed())
+	})
+})
@@ -0,0 +1,209 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// State of a VM, same values as reported by 'virsh domstate'
+type State string
+
+const (
+	StateCrashed     State = "crashed"
+	StateIdle        State = "idle"
+	StateNoState     State = "no state"
+	StatePaused      State = "paused"
+	StatePMSuspended State = "pmsuspended"
+	StateRunning     State = "running"
+	StateShutdown    State = "in shutdown"
+	StateShutOff     State = "shut off"
+	StateUndefined   State = "undefined"
+)
+
+// Boot type of a VM
+type BootType string
+
+const (
+	// Boot on an existing disk image, nothing is installed
+	BootImport BootType = "import"
+	// Boot on an ISO image, disk is used as installation target
+	BootISO BootType = "iso"
+	// Boot through the network with iPXE, disk is used as installation target
+	BootPXE BootType = "pxe"
+	// Boot on a copy of a raw disk image
+	BootRaw BootType = "raw"
+)
+
+// ErrNotFound is returned when the VM does not exist
+var ErrNotFound = errors.New("VM not found")
+
+// Hypervisor manages the lifecycle of the VMs
+type Hypervisor interface {
+	Define(o *Options) error
+	Start(name string) error
+	Shutdown(name string) error
+	Destroy(name string) error
+	State(name string) (State, error)
+	ConsoleLog(name string) (string, error)
+	XML(name string) (string, error)
+	Snapshot(name, snapshot string) error
+}
+
+// Firmware to use, BIOS is used if not set
+type Firmware struct {
+	// Path of the OVMF code file
+	Code string
+	// Path of the OVMF variables template file
+	VarsTemplate string
+	// Enable secure boot (also enables SMM)
+	SecureBoot bool
+}
+
+// Options used to define a VM
+type Options struct {
+	// Name of the VM
+	Name string
+	// MAC address of the network interface
+	MAC string
+	// Libvirt network to connect to
+	Network string
+	// Boot type
+	BootType BootType
+	// ISO or disk image to use, depending on the boot type
+	Media string
+	// Disk image file, created if needed
+	Disk string
+	// Disk bus (scsi, sata, virtio...)
+	DiskBus string
+	// Disk size in GB (not used with BootImport)
+	DiskSize int
+	// Memory in MB
+	Memory int
+	// Number of vCPUs
+	CPU int
+	// Use hugepages (2MB) for the VM memory
+	Hugepages bool
+	// Add a virtual TPM 2.0 device
+	TPM bool
+	// Firmware configuration
+	Firmware *Firmware
+	// Stop the VM instead of rebooting it at the end of the installation,
+	// like virt-install --noreboot, later reboots are not affected
+	NoReboot bool
+	// File where the serial console output is logged
+	ConsoleLogFile string
+}
+
+/*
+Check that options are valid
+  - @returns Nothing or an error
+*/
+func (o *Options) Validate() error {
+	var errs []error
+
+	if o.Name == "" {
+		errs = append(errs, errors.New("name is missing"))
+	}
+	if o.Disk == "" {
+		errs = append(errs, errors.New("disk is missing"))
+	}
+	if o.Memory <= 0 || o.CPU <= 0 {
+		errs = append(errs, fmt.Errorf("memory (%d) and CPU (%d) must be positive", o.Memory, o.CPU))
+	}
+
+	switch o.BootType {
+	case BootImport, BootPXE:
+	case BootISO, BootRaw:
+		if o.Media == "" {
+			errs = append(errs, fmt.Errorf("media is needed for %s boot", o.BootType))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown boot type %q", o.BootType))
+	}
+
+	if o.BootType != BootImport && o.DiskSize <= 0 {
+		errs = append(errs, fmt.Errorf("disk size (%d) must be positive", o.DiskSize))
+	}
+
+	return errors.Join(errs...)
+}
+
+/*
+Configure hugepages on the host if needed
+  - @param reserved Memory (in MB) to keep for the host
+  - @returns The number of configured hugepages or an error
+*/
+func ConfigureHugepages(reserved int) (int, error) {
+	nr, err := readInt("/proc/sys/vm/nr_hugepages")
+	if err != nil {
+		return 0, err
+	}
+
+	// Already configured
+	if nr > 0 {
+		return nr, nil
+	}
+
+	memTotal, err := memTotalKB()
+	if err != nil {
+		return 0, err
+	}
+
+	// Number of hugepages (with hugepagesize set to 2MB)
+	value := (memTotal - reserved*1024) / 2048
+	if value <= 0 {
+		return 0, nil
+	}
+
+	// Needs write access to the sysctl, usually as root
+	err = os.WriteFile("/proc/sys/vm/nr_hugepages", []byte(strconv.Itoa(value)), 0644)
+	if err != nil {
+		return 0, fmt.Errorf("cannot configure hugepages: %w", err)
+	}
+
+	return readInt("/proc/sys/vm/nr_hugepages")
+}
+
+// readInt reads a file containing only an integer
+func readInt(file string) (int, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// memTotalKB returns the total memory of the host in KB
+func memTotalKB() (int, error) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			return strconv.Atoi(fields[1])
+		}
+	}
+
+	return 0, errors.New("MemTotal not found in /proc/meminfo")
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vm_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/vm"
+	"libvirt.org/go/libvirtxml"
+)
+
+func node(bootType vm.BootType) *vm.Options {
+	return &vm.Options{
+		Name:     "node-001",
+		MAC:      "52:54:00:00:00:01",
+		BootType: bootType,
+		Media:    "/tmp/elemental.iso",
+		Disk:     "/tmp/node-001/node-001.img",
+		DiskSize: 30,
+		Memory:   4096,
+		CPU:      4,
+	}
+}
+
+func parse(o *vm.Options) *libvirtxml.Domain {
+	out, err := vm.DomainXML(o)
+	Expect(err).To(Not(HaveOccurred()))
+
+	d := &libvirtxml.Domain{}
+	Expect(d.Unmarshal(out)).To(Succeed())
+
+	return d
+}
+
+var _ = Describe("Domain XML", func() {
+	It("Adds the ISO as second boot device", func() {
+		d := parse(node(vm.BootISO))
+
+		Expect(d.Devices.Disks).To(HaveLen(2))
+		Expect(d.Devices.Disks[0].Boot.Order).To(Equal(uint(1)))
+		Expect(d.Devices.Disks[1].Device).To(Equal("cdrom"))
+		Expect(d.Devices.Disks[1].Source.File.File).To(Equal("/tmp/elemental.iso"))
+		Expect(d.Devices.Disks[1].Boot.Order).To(Equal(uint(2)))
+		Expect(d.Devices.Interfaces[0].Boot).To(BeNil())
+	})
+
+	It("Boots on the network interface with PXE", func() {
+		d := parse(node(vm.BootPXE))
+
+		Expect(d.Devices.Disks).To(HaveLen(1))
+		Expect(d.Devices.Interfaces[0].Boot.Order).To(Equal(uint(2)))
+		Expect(d.Devices.Interfaces[0].MAC.Address).To(Equal("52:54:00:00:00:01"))
+	})
+
+	It("Configures TPM, hugepages and secure boot", func() {
+		o := node(vm.BootRaw)
+		o.TPM = true
+		o.Hugepages = true
+		o.Firmware = &vm.Firmware{Code: "/ovmf-code.bin", VarsTemplate: "/ovmf-vars.fd", SecureBoot: true}
+		d := parse(o)
+
+		Expect(d.Devices.TPMs).To(HaveLen(1))
+		Expect(d.Devices.TPMs[0].Backend.Emulator.Version).To(Equal("2.0"))
+		Expect(d.MemoryBacking.MemoryHugePages.Hugepages[0].Size).To(Equal(uint(2)))
+		Expect(d.OS.Loader.Secure).To(Equal("yes"))
+		Expect(d.OS.NVRam.Template).To(Equal("/ovmf-vars.fd"))
+		Expect(d.Features.SMM.State).To(Equal("on"))
+	})
+
+	It("Stops the VM instead of rebooting it if asked", func() {
+		o := node(vm.BootISO)
+		Expect(parse(o).OnReboot).To(Equal("restart"))
+
+		o.NoReboot = true
+		Expect(parse(o).OnReboot).To(Equal("destroy"))
+	})
+
+	It("Does not add TPM or firmware if not asked", func() {
+		d := parse(node(vm.BootPXE))
+
+		Expect(d.Devices.TPMs).To(BeEmpty())
+		Expect(d.MemoryBacking).To(BeNil())
+		Expect(d.OS.Loader).To(BeNil())
+	})
+
+	It("Rejects invalid options", func() {
+		o := node("floppy")
+		o.Media = ""
+		o.CPU = 0
+
+		_, err := vm.DomainXML(o)
+		Expect(err).To(MatchError(ContainSubstring("unknown boot type")))
+		Expect(err).To(MatchError(ContainSubstring("must be positive")))
+
+		o = node(vm.BootISO)
+		o.Media = ""
+		_, err = vm.DomainXML(o)
+		Expect(err).To(MatchError(ContainSubstring("media is needed")))
+	})
+})
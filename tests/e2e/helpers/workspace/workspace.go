@@ -0,0 +1,252 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspace
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Environment variables used to override the default directories
+const (
+	ChartsEnv     = "E2E_CHARTS_DIR"
+	ClusterctlEnv = "E2E_CLUSTERCTL_DIR"
+	LogsEnv       = "E2E_LOGS_DIR"
+	ProviderEnv   = "E2E_PROVIDER_DIR"
+	RootEnv       = "E2E_ROOT_DIR"
+)
+
+// Directory of the assets, relative to the root of the repository,
+// used to find the root when it is not set
+var assetsDir = filepath.Join("tests", "assets")
+
+// ErrRootNotFound is returned when no repository root is found from the current directory
+var ErrRootNotFound = errors.New("repository root not found, set " + RootEnv)
+
+// Options to resolve the workspace, empty values use the defaults
+type Options struct {
+	Charts     string
+	Clusterctl string
+	Logs       string
+	Provider   string
+	Root       string
+}
+
+// Workspace contains the absolute paths of the directories used by the suite
+type Workspace struct {
+	Assets     string
+	Charts     string
+	Clusterctl string
+	Logs       string
+	Provider   string
+	Root       string
+	Scripts    string
+	Suite      string
+}
+
+/*
+Get the options from the environment
+  - @returns Options structure, with the values of the environment variables
+*/
+func OptionsFromEnv() Options {
+	return Options{
+		Charts:     os.Getenv(ChartsEnv),
+		Clusterctl: os.Getenv(ClusterctlEnv),
+		Logs:       os.Getenv(LogsEnv),
+		Provider:   os.Getenv(ProviderEnv),
+		Root:       os.Getenv(RootEnv),
+	}
+}
+
+/*
+Bind the options to command line flags, environment variables are used as defaults
+  - @param fs Flag set where the flags are added
+  - @returns Pointer to the Options structure filled when the flags are parsed
+*/
+func BindFlags(fs *flag.FlagSet) *Options {
+	o := OptionsFromEnv()
+	fs.StringVar(&o.Root, "e2e.root-dir", o.Root, "root of the repository, shared over HTTP")
+	fs.StringVar(&o.Provider, "e2e.provider-dir", o.Provider, "checkout of the elemental CAPI provider")
+	fs.StringVar(&o.Logs, "e2e.logs-dir", o.Logs, "directory where logs and reports are written")
+	fs.StringVar(&o.Charts, "e2e.charts-dir", o.Charts, "directory of the local Helm chart archives")
+	fs.StringVar(&o.Clusterctl, "e2e.clusterctl-dir", o.Clusterctl, "local clusterctl repository of the CAPI providers")
+
+	return &o
+}
+
+/*
+Find the root of the repository
+  - @param dir Directory where the search starts, going up to the filesystem root
+  - @returns Absolute path of the first directory containing the assets or an error
+*/
+func FindRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, assetsDir)); err == nil && fi.IsDir() {
+			return dir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrRootNotFound
+		}
+		dir = parent
+	}
+}
+
+/*
+Resolve the workspace directories and create the logs directory
+  - @param o Options to use, the root is searched from the current directory if not set
+  - @returns Pointer to the Workspace structure or an error
+*/
+func Resolve(o Options) (*Workspace, error) {
+	root := o.Root
+	if root == "" {
+		pwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		if root, err = FindRoot(pwd); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Workspace{
+		Assets:     filepath.Join(root, assetsDir),
+		Charts:     filepath.Join(root, "charts"),
+		Clusterctl: filepath.Join(root, "clusterctl-repository"),
+		Logs:       filepath.Join(root, "tests", "e2e", "logs"),
+		Provider:   filepath.Join(root, "cluster-api-provider-elemental"),
+		Root:       root,
+		Scripts:    filepath.Join(root, "tests", "scripts"),
+		Suite:      filepath.Join(root, "tests", "e2e"),
+	}
+
+	if o.Charts != "" {
+		if w.Charts, err = filepath.Abs(o.Charts); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Clusterctl != "" {
+		if w.Clusterctl, err = filepath.Abs(o.Clusterctl); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Logs != "" {
+		if w.Logs, err = filepath.Abs(o.Logs); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Provider != "" {
+		if w.Provider, err = filepath.Abs(o.Provider); err != nil {
+			return nil, err
+		}
+	}
+
+	// A root set by the user should still contain the assets
+	if _, err := os.Stat(w.Assets); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(w.Logs, 0755); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+/*
+Get the path of an asset
+  - @param name Name of the asset, can contain glob patterns
+  - @returns Absolute path of the asset
+*/
+func (w *Workspace) Asset(name string) string {
+	return filepath.Join(w.Assets, name)
+}
+
+/*
+Get the path of a chart archive
+  - @param name Name of the archive, can contain glob patterns
+  - @returns Absolute path of the archive
+*/
+func (w *Workspace) Chart(name string) string {
+	return filepath.Join(w.Charts, name)
+}
+
+/*
+Get the path of a log file
+  - @param name Name of the file, relative to the logs directory
+  - @returns Absolute path of the file
+*/
+func (w *Workspace) Log(name string) string {
+	return filepath.Join(w.Logs, name)
+}
+
+/*
+Get the path of a file in the provider checkout
+  - @param name Name of the file, relative to the provider checkout
+  - @returns Absolute path of the file
+*/
+func (w *Workspace) ProviderFile(name string) string {
+	return filepath.Join(w.Provider, name)
+}
+
+/*
+Get the path of a file at the root of the repository
+  - @param name Name of the file, can contain glob patterns
+  - @returns Absolute path of the file
+*/
+func (w *Workspace) RootFile(name string) string {
+	return filepath.Join(w.Root, name)
+}
+
+/*
+Get the path of a script
+  - @param name Name of the script
+  - @returns Absolute path of the script
+*/
+func (w *Workspace) Script(name string) string {
+	return filepath.Join(w.Scripts, name)
+}
+
+/*
+Prepare a command executed in a specific directory
+NOTE: the current directory of the process is never changed, so a failing spec doesn't affect the next ones
+  - @param dir Directory where the command is executed
+  - @param name Name of the command
+  - @param args Arguments of the command
+  - @returns Pointer to the Cmd structure
+*/
+func Command(dir, name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+
+	return cmd
+}
@@ -0,0 +1,113 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspace_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/workspace"
+)
+
+var _ = Describe("Workspace", func() {
+	var root string
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(root, "tests", "assets"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(root, "tests", "e2e", "sub"), 0755)).To(Succeed())
+	})
+
+	It("finds the root from a sub-directory", func() {
+		r, err := workspace.FindRoot(filepath.Join(root, "tests", "e2e", "sub"))
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(r).To(Equal(root))
+
+		_, err = workspace.FindRoot(filepath.Join(root, ".."))
+		Expect(err).To(MatchError(workspace.ErrRootNotFound))
+	})
+
+	It("resolves the default directories", func() {
+		w, err := workspace.Resolve(workspace.Options{Root: root})
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(*w).To(Equal(workspace.Workspace{
+			Assets:     filepath.Join(root, "tests", "assets"),
+			Charts:     filepath.Join(root, "charts"),
+			Clusterctl: filepath.Join(root, "clusterctl-repository"),
+			Logs:       filepath.Join(root, "tests", "e2e", "logs"),
+			Provider:   filepath.Join(root, "cluster-api-provider-elemental"),
+			Root:       root,
+			Scripts:    filepath.Join(root, "tests", "scripts"),
+			Suite:      filepath.Join(root, "tests", "e2e"),
+		}))
+		Expect(w.Logs).To(BeADirectory())
+
+		Expect(w.Asset("cluster.yaml")).To(Equal(filepath.Join(root, "tests", "assets", "cluster.yaml")))
+		Expect(w.Chart("rancher-2.8.3.tgz")).To(Equal(filepath.Join(root, "charts", "rancher-2.8.3.tgz")))
+		Expect(w.Log("report.xml")).To(Equal(filepath.Join(root, "tests", "e2e", "logs", "report.xml")))
+		Expect(w.ProviderFile("iso")).To(Equal(filepath.Join(root, "cluster-api-provider-elemental", "iso")))
+		Expect(w.RootFile("install.ipxe")).To(Equal(filepath.Join(root, "install.ipxe")))
+		Expect(w.Script("deploy-chartmuseum")).To(Equal(filepath.Join(root, "tests", "scripts", "deploy-chartmuseum")))
+	})
+
+	It("uses the overridden directories", func() {
+		other := GinkgoT().TempDir()
+		w, err := workspace.Resolve(workspace.Options{
+			Root:       root,
+			Charts:     filepath.Join(other, "charts"),
+			Clusterctl: filepath.Join(other, "clusterctl"),
+			Logs:       filepath.Join(other, "logs"),
+			Provider:   filepath.Join(other, "provider"),
+		})
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(w.Logs).To(Equal(filepath.Join(other, "logs")))
+		Expect(w.Logs).To(BeADirectory())
+		Expect(w.Provider).To(Equal(filepath.Join(other, "provider")))
+		Expect(w.Charts).To(Equal(filepath.Join(other, "charts")))
+		Expect(w.Clusterctl).To(Equal(filepath.Join(other, "clusterctl")))
+	})
+
+	It("fails if the root doesn't contain the assets", func() {
+		_, err := workspace.Resolve(workspace.Options{Root: GinkgoT().TempDir()})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("uses the environment as default for the flags", func() {
+		GinkgoT().Setenv(workspace.RootEnv, root)
+		GinkgoT().Setenv(workspace.ProviderEnv, "/env/provider")
+
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		o := workspace.BindFlags(fs)
+		Expect(*o).To(Equal(workspace.Options{Root: root, Provider: "/env/provider"}))
+
+		Expect(fs.Parse([]string{"-e2e.provider-dir", "/flag/provider", "-e2e.logs-dir", "/flag/logs"})).To(Succeed())
+		Expect(*o).To(Equal(workspace.Options{Root: root, Provider: "/flag/provider", Logs: "/flag/logs"}))
+	})
+
+	It("runs commands in a directory without changing the current one", func() {
+		pwd, err := os.Getwd()
+		Expect(err).To(Not(HaveOccurred()))
+
+		out, err := workspace.Command(root, "pwd").Output()
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(strings.TrimSpace(string(out))).To(Equal(root))
+
+		Expect(os.Getwd()).To(Equal(pwd))
+	})
+})
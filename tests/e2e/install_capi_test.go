@@ -17,6 +17,7 @@ package e2e_test
 import (
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,6 +26,10 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+	"github.com/rancher/elemental/tests/e2e/helpers/clusterctl"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/workspace"
 )
 
 var _ = Describe("E2E - Install CAPI", Label("install-capi"), func() {
@@ -39,11 +44,23 @@ var _ = Describe("E2E - Install CAPI", Label("install-capi"), func() {
 	// Define local Kubeconfig file
 	localKubeconfig := os.Getenv("HOME") + "/.kube/config"
 
+	BeforeEach(func() {
+		if cfg.OperatorType != config.OperatorTypeCAPI {
+			Skip("OPERATOR_TYPE is not " + config.OperatorTypeCAPI)
+		}
+	})
+
 	It("Install CAPI components", func() {
 		password := "root"
 		userName := "root"
 		archiveName := "cluster-api-provider-elemental"
 
+		// Compiled provider, unless an older one is installed to test the upgrade
+		elementalVersion := "v0.0.0"
+		if cfg.CAPIElementalVersion != "" {
+			elementalVersion = cfg.CAPIElementalVersion
+		}
+
 		// For ssh access
 		client := &tools.Client{
 			Host:     "192.168.122.100:22",
@@ -55,41 +72,58 @@ var _ = Describe("E2E - Install CAPI", Label("install-capi"), func() {
 		Expect(err).To(Not(HaveOccurred()))
 
 		By("Creating the namespace where resources will be deployed", func() {
-			err := kubectl.CreateNamespace(clusterNS)
+			err := kubectl.CreateNamespace(cfg.ClusterNS)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
 		By("Installing and configuring clusterctl", func() {
-			err := exec.Command("curl", "-sLO", "https://github.com/kubernetes-sigs/cluster-api/releases/download/v1.5.3/clusterctl-linux-amd64").Run()
+			err := workspace.Command(ws.Suite, "curl", "-sLO", "https://github.com/kubernetes-sigs/cluster-api/releases/download/v1.5.3/clusterctl-linux-amd64").Run()
 			Expect(err).To(Not(HaveOccurred()))
-			err = exec.Command("sudo", "install", "-o", "root", "-g", "root", "-m", "0755", "clusterctl-linux-amd64", "/usr/local/bin/clusterctl").Run()
+			err = workspace.Command(ws.Suite, "sudo", "install", "-o", "root", "-g", "root", "-m", "0755", "clusterctl-linux-amd64", "/usr/local/bin/clusterctl").Run()
 			Expect(err).To(Not(HaveOccurred()))
 			err = exec.Command("bash", "-c", "mkdir -p $HOME/.cluster-api").Run()
 			Expect(err).To(Not(HaveOccurred()))
-			err = exec.Command("bash", "-c", "cp "+clusterctlYaml+" $HOME/.cluster-api").Run()
+			if cfg.CAPIElementalVersion == "" {
+				err = exec.Command("bash", "-c", "cp "+ws.Asset(clusterctlYaml)+" $HOME/.cluster-api").Run()
+				Expect(err).To(Not(HaveOccurred()))
+				return
+			}
+
+			// Providers are installed from the local repository, see upgrade-capi
+			providers := CAPIProviders(elementalVersion, cfg.CAPIRKE2Version)
+			for _, p := range providers {
+				err = p.Check(ws.Clusterctl)
+				Expect(err).To(Not(HaveOccurred()), "populate the local repository with make e2e-install-clusterctl-repository")
+			}
+			err = clusterctl.WriteConfig(os.Getenv("HOME")+"/.cluster-api/"+clusterctlYaml, ws.Clusterctl, providers...)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
 		By("Compiling latest elemental CAPI provider", func() {
-			err := os.Chdir("../../cluster-api-provider-elemental")
-			Expect(err).To(Not(HaveOccurred()))
-			err = exec.Command("make", "docker-build").Run()
+			err := workspace.Command(ws.Provider, "make", "docker-build").Run()
 			Expect(err).To(Not(HaveOccurred()))
-			err = exec.Command("bash", "-c", "docker save ghcr.io/rancher-sandbox/cluster-api-provider-elemental -o "+archiveName).Run()
+			err = workspace.Command(ws.Provider, "docker", "save", "ghcr.io/rancher-sandbox/cluster-api-provider-elemental", "-o", archiveName).Run()
 			Expect(err).To(Not(HaveOccurred()))
-			err = client.SendFile(archiveName, "/tmp/"+archiveName, "0644")
+			err = client.SendFile(ws.ProviderFile(archiveName), "/tmp/"+archiveName, "0644")
 			Expect(err).To(Not(HaveOccurred()))
 			_, err = client.RunSSH("/usr/local/bin/k3s ctr images import /tmp/" + archiveName)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
 		By("Installing CAPI core, control plane and bootstrap providers", func() {
-			out, err := exec.Command("/usr/local/bin/clusterctl",
-				"--v", "4",
-				"init",
-				"--bootstrap", bootstrapProvider,
-				"--control-plane", controlPlaneProvider,
-				"--infrastructure", "elemental:v0.0.0").CombinedOutput()
+			args := []string{"--v", "4", "init"}
+			if cfg.CAPIElementalVersion == "" {
+				args = append(args,
+					"--bootstrap", cfg.BootstrapProvider,
+					"--control-plane", cfg.ControlPlaneProvider,
+					"--infrastructure", "elemental:"+elementalVersion)
+			} else {
+				// Versions have to be set, the local repository also contains the newer ones
+				for _, p := range CAPIProviders(elementalVersion, cfg.CAPIRKE2Version) {
+					args = append(args, p.Flag(), p.String())
+				}
+			}
+			out, err := exec.Command("/usr/local/bin/clusterctl", args...).CombinedOutput()
 			// Show command output, easier to debug
 			GinkgoWriter.Printf("%s\n", string(out))
 			Expect(err).To(Not(HaveOccurred()))
@@ -110,93 +144,78 @@ var _ = Describe("E2E - Install CAPI", Label("install-capi"), func() {
 		})
 
 		By("Exposing Elemental API server", func() {
-			err := os.Chdir("../tests/e2e")
-			Expect(err).To(Not(HaveOccurred()))
-			err = kubectl.Apply("elemental-system", elementalAPIYaml)
+			err := kubectl.Apply("elemental-system", ws.Asset(elementalAPIYaml))
 			Expect(err).To(Not(HaveOccurred()))
 			// TODO: not needed but can be usefull
 			// check if service is ready
 		})
 
-		By("Creating Elemental cluster", func() {
-			out, err := exec.Command("clusterctl", "generate", "cluster",
-				"--control-plane-machine-count=1",
-				"--worker-machine-count=2",
-				"--infrastructure", "elemental:v0.0.0",
-				"--flavor", bootstrapProvider,
-				"--target-namespace", clusterNS,
-				clusterName,
-				"--kubernetes-version="+k8sDownstreamVersion,
-			).Output()
-			Expect(err).To(Not(HaveOccurred()))
+		By("Creating Elemental cluster(s)", func() {
+			for _, c := range cfg.Clusters() {
+				out, err := exec.Command("clusterctl", "generate", "cluster",
+					"--control-plane-machine-count="+strconv.Itoa(c.ControlPlanes),
+					"--worker-machine-count="+strconv.Itoa(c.Workers),
+					"--infrastructure", "elemental:"+elementalVersion,
+					"--flavor", cfg.BootstrapProvider,
+					"--target-namespace", cfg.ClusterNS,
+					c.Name,
+					"--kubernetes-version="+cfg.K8sDownstreamVersion,
+				).Output()
+				Expect(err).To(Not(HaveOccurred()))
 
-			err = os.WriteFile("/tmp/"+clusterName+"-manifest.yaml", []byte(out), os.ModePerm)
-			Expect(err).To(Not(HaveOccurred()))
-			err = kubectl.Apply(clusterNS, "/tmp/"+clusterName+"-manifest.yaml")
-			Expect(err).To(Not(HaveOccurred()))
+				err = os.WriteFile("/tmp/"+c.Name+"-manifest.yaml", []byte(out), os.ModePerm)
+				Expect(err).To(Not(HaveOccurred()))
+				err = kubectl.Apply(cfg.ClusterNS, "/tmp/"+c.Name+"-manifest.yaml")
+				Expect(err).To(Not(HaveOccurred()))
+			}
 		})
 
-		By("Creating Elemental Machine registration", func() {
+		By("Creating Elemental Machine registration(s)", func() {
 			// Set temporary file
 			registrationTmp, err := tools.CreateTemp("machineRegistration")
 			Expect(err).To(Not(HaveOccurred()))
 			defer os.Remove(registrationTmp)
 
 			// Remove quotes from the url
-			url := strings.Trim(elementalAPIEndpoint, "\"\"")
-
-			patterns := []YamlPattern{
-				{
-					key:   "%CLUSTER_NAME%",
-					value: clusterName,
-				},
-				{
-					key:   "%NAMESPACE%",
-					value: clusterNS,
-				},
-				{
-					key:   "%PASSWORD%",
-					value: userPassword,
-				},
-				{
-					key:   "%ELEMENTAL_API_ENDPOINT%",
-					value: url,
-				},
-				{
-					key:   "%USER%",
-					value: userName,
-				},
-				{
-					key:   "%VM_NAME%",
-					value: vmNameRoot,
-				},
-			}
+			url := strings.Trim(cfg.ElementalAPIEndpoint, "\"\"")
 
-			// Save original file as it will have to be modified twice
-			err = tools.CopyFile(registrationYaml, registrationTmp)
-			Expect(err).To(Not(HaveOccurred()))
+			registration := assets.Template{
+				File:       registrationYaml,
+				APIVersion: "infrastructure.cluster.x-k8s.io/v1beta1",
+				Kind:       "ElementalRegistration",
+			}
+			if cfg.EmulateTPM {
+				registration.Overlays = append(registration.Overlays, ws.Asset(emulateTPMYaml))
+			}
 
-			// Create Yaml file
-			for _, p := range patterns {
-				err := tools.Sed(p.key, p.value, registrationTmp)
+			// One registration per cluster, so nodes only join their own cluster
+			for _, c := range cfg.Clusters() {
+				err = registration.RenderFile(&assets.Values{
+					ClusterName:          c.Name,
+					ElementalAPIEndpoint: url,
+					EmulateTPM:           cfg.EmulateTPM,
+					Namespace:            cfg.ClusterNS,
+					Password:             userPassword,
+					User:                 userName,
+				}, registrationTmp)
 				Expect(err).To(Not(HaveOccurred()))
-			}
 
-			// Apply to k8s
-			err = kubectl.Apply(clusterNS, registrationTmp)
-			Expect(err).To(Not(HaveOccurred()))
+				// Apply to k8s
+				err = kubectl.Apply(cfg.ClusterNS, registrationTmp)
+				Expect(err).To(Not(HaveOccurred()))
 
-			// Check that the machine registration is correctly created
-			CheckCreatedRegistration(clusterNS, "machine-registration-master-"+clusterName)
+				// Check that the machine registration is correctly created
+				CheckCreatedRegistration(cfg.ClusterNS, "machine-registration-master-"+c.Name)
+			}
 
 			// Generate the config files
-			// TODO: replace sleep with a check
-			time.Sleep(2 * time.Minute)
-			err = os.Chdir("../../cluster-api-provider-elemental")
-			Expect(err).To(Not(HaveOccurred()))
-			err = exec.Command("bash", "-c", "./test/scripts/print_agent_config.sh -n "+clusterNS+" -r machine-registration-master-"+clusterName+" > iso/config/my-config.yaml").Run()
-			Expect(err).To(Not(HaveOccurred()))
-
+			// NOTE: only used by the ISO, which is not available with multi-cluster
+			if cfg.TestType != config.TestTypeMulti {
+				// TODO: replace sleep with a check
+				time.Sleep(2 * time.Minute)
+				err = workspace.Command(ws.Provider, "bash", "-c", "./test/scripts/print_agent_config.sh -n "+cfg.ClusterNS+" -r machine-registration-master-"+cfg.ClusterName+" > iso/config/my-config.yaml").Run()
+				Expect(err).To(Not(HaveOccurred()))
+			}
 		})
 	})
 })
@@ -0,0 +1,176 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/rancher"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/charts"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/workspace"
+)
+
+/*
+Get the archive of a chart, pulled from its repository if not available locally
+  - @param c Chart to get
+  - @param dir Directory where the archive is searched and pulled
+  - @param local True to use the archive already available in dir
+  - @returns Path of the archive, the function will fail through Ginkgo in case of issue
+*/
+func getChartArchive(c charts.Chart, dir string, local bool) string {
+	if local {
+		archive, err := c.Find(dir)
+		if err == nil {
+			GinkgoWriter.Printf("Using local archive %s\n", archive)
+			return archive
+		}
+		Expect(err).To(MatchError(charts.ErrNotFound))
+	}
+
+	RunHelmCmdWithRetry(c.PullArgs(dir)...)
+	archive, err := c.Find(dir)
+	Expect(err).To(Not(HaveOccurred()))
+	GinkgoWriter.Printf("Using %s pulled from %s\n", archive, c.Repo)
+
+	return archive
+}
+
+var _ = Describe("E2E - Install Rancher Manager", Label("install"), func() {
+	// Create kubectl context
+	// Default timeout is too small, so New() cannot be used
+	k := &kubectl.Kubectl{
+		Namespace:    "",
+		PollTimeout:  tools.SetTimeout(300 * time.Second),
+		PollInterval: 500 * time.Millisecond,
+	}
+
+	// Define local Kubeconfig file
+	localKubeconfig := os.Getenv("HOME") + "/.kube/config"
+
+	It("Install Rancher Manager and the elemental operator", func() {
+		archives := map[string]string{}
+
+		err := os.Setenv("KUBECONFIG", localKubeconfig)
+		Expect(err).To(Not(HaveOccurred()))
+
+		By("Getting the chart archives", func() {
+			// Local archives are only used if their directory is set, so the install works offline
+			local := wsOptions.Charts != ""
+			dir := ws.Charts
+			if !local {
+				dir = GinkgoT().TempDir()
+			} else {
+				err := os.MkdirAll(dir, 0755)
+				Expect(err).To(Not(HaveOccurred()))
+			}
+
+			for _, c := range []charts.Chart{
+				{Name: "cert-manager", Repo: "https://charts.jetstack.io", Version: cfg.CertManagerVersion},
+				{Name: "rancher", Repo: "https://releases.rancher.com/server-charts/latest", Version: cfg.RancherVersion},
+			} {
+				archives[c.Name] = getChartArchive(c, dir, local)
+			}
+
+			for _, c := range []charts.Chart{
+				{Name: "elemental-operator-crds-chart", Repo: cfg.OperatorRepo},
+				{Name: "elemental-operator-chart", Repo: cfg.OperatorRepo},
+			} {
+				// OPERATOR_REPO is only optional if the operator archives are available locally
+				if c.Repo == "" {
+					_, err := c.Find(dir)
+					Expect(local && err == nil).To(BeTrue(), "%s is not available in %s, OPERATOR_REPO is needed to pull it", c.Name, workspace.ChartsEnv)
+				}
+				archives[c.Name] = getChartArchive(c, dir, local)
+			}
+		})
+
+		By("Installing cert-manager", func() {
+			RunHelmCmdWithRetry("upgrade", "--install", "cert-manager", archives["cert-manager"],
+				"--namespace", "cert-manager",
+				"--create-namespace",
+				"--set", "installCRDs=true",
+				"--wait", "--wait-for-jobs",
+			)
+
+			checkList := [][]string{
+				{"cert-manager", "app.kubernetes.io/component=controller"},
+				{"cert-manager", "app.kubernetes.io/component=webhook"},
+				{"cert-manager", "app.kubernetes.io/component=cainjector"},
+			}
+			Eventually(func() error {
+				return rancher.CheckPod(k, checkList)
+			}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(BeNil())
+		})
+
+		By("Installing Rancher Manager", func() {
+			RunHelmCmdWithRetry("upgrade", "--install", "rancher", archives["rancher"],
+				"--namespace", "cattle-system",
+				"--create-namespace",
+				"--set", "hostname="+cfg.RancherHostname,
+				"--set", "bootstrapPassword="+userPassword,
+				"--set", "replicas=1",
+				"--set", "extraEnv[0].name=CATTLE_SERVER_URL",
+				"--set", "extraEnv[0].value=https://"+cfg.RancherHostname,
+				"--wait", "--wait-for-jobs",
+			)
+
+			// Wait for all pods to be started
+			checkList := [][]string{
+				{"cattle-system", "app=rancher"},
+				{"cattle-system", "app=rancher-webhook"},
+				{"cattle-fleet-local-system", "app=fleet-agent"},
+				{"cattle-fleet-system", "app=fleet-controller"},
+			}
+			Eventually(func() error {
+				return rancher.CheckPod(k, checkList)
+			}, tools.SetTimeout(10*time.Minute), 30*time.Second).Should(BeNil())
+		})
+
+		By("Installing the elemental operator", func() {
+			for _, c := range []string{"elemental-operator-crds", "elemental-operator"} {
+				RunHelmCmdWithRetry("upgrade", "--install", c, archives[c+"-chart"],
+					"--namespace", "cattle-elemental-system",
+					"--create-namespace",
+					"--wait", "--wait-for-jobs",
+				)
+			}
+
+			checkList := [][]string{
+				{"cattle-elemental-system", "app=elemental-operator"},
+			}
+			Eventually(func() error {
+				return rancher.CheckPod(k, checkList)
+			}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(BeNil())
+		})
+
+		By("Recording the elemental operator version", func() {
+			var version string
+			Eventually(func() error {
+				var err error
+				version, err = elemental.GetOperatorVersion(k8s)
+				return err
+			}, tools.SetTimeout(2*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+
+			GinkgoWriter.Printf("Elemental operator version: %s\n", version)
+			AddReportEntry("Elemental operator version", version)
+		})
+	})
+})
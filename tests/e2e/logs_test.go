@@ -15,13 +15,12 @@ limitations under the License.
 package e2e_test
 
 import (
-	"os"
-	"os/exec"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/workspace"
 )
 
 func checkRC(err error) {
@@ -46,20 +45,17 @@ var _ = Describe("E2E - Getting logs node", Label("logs"), func() {
 				"crust-gather-installer",
 			}
 
-			_ = os.Mkdir("logs", 0755)
-			_ = os.Chdir("logs")
-			myDir, _ := os.Getwd()
-
+			// Everything is downloaded and collected in the logs directory
 			for _, b := range []binary{crustGather} {
 				Eventually(func() error {
-					return exec.Command("curl", "-L", b.Url, "-o", b.Name).Run()
+					return workspace.Command(ws.Logs, "curl", "-L", b.Url, "-o", b.Name).Run()
 				}, tools.SetTimeout(1*time.Minute), 5*time.Second).Should(BeNil())
 
-				err := exec.Command("chmod", "+x", b.Name).Run()
+				err := workspace.Command(ws.Logs, "chmod", "+x", b.Name).Run()
 				checkRC(err)
-				err = exec.Command("sudo", myDir+"/"+b.Name, "-f", "-y").Run()
+				err = workspace.Command(ws.Logs, "sudo", ws.Log(b.Name), "-f", "-y").Run()
 				checkRC(err)
-				err = exec.Command("crust-gather", "collect").Run()
+				err = workspace.Command(ws.Logs, "crust-gather", "collect").Run()
 				checkRC(err)
 			}
 		})
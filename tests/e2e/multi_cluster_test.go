@@ -0,0 +1,69 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+var _ = Describe("E2E - Check multiple clusters", Label("multi-cluster"), func() {
+	var wg sync.WaitGroup
+
+	BeforeEach(func() {
+		if cfg.TestType != config.TestTypeMulti {
+			Skip("TEST_TYPE is not " + config.TestTypeMulti)
+		}
+		RequireVMRange()
+	})
+
+	It("Check that each cluster only uses its own nodes", func() {
+		for _, c := range cfg.Clusters() {
+			wg.Add(1)
+			go func(c config.Cluster) {
+				defer wg.Done()
+				defer GinkgoRecover()
+
+				By("Checking cluster "+c.Name+" state", func() {
+					WaitCAPICluster(cfg.ClusterNS, c.Name)
+				})
+
+				By("Checking that "+c.Name+" machines are nodes registered for it", func() {
+					// Hostnames of the nodes added with the cluster registration
+					hostNames := []string{}
+					for index := c.VMIndex; index <= c.VMNumbers; index++ {
+						hostNames = append(hostNames, elemental.SetHostname(vmNameRoot, index))
+					}
+
+					list := &elemental.MachineList{}
+					err := k8s.List(elemental.KindMachine, cfg.ClusterNS, "cluster.x-k8s.io/cluster-name="+c.Name, list)
+					Expect(err).To(Not(HaveOccurred()))
+					Expect(list.Items).To(HaveLen(c.Machines()))
+
+					for _, m := range list.Items {
+						Expect(m.Status.NodeRef).To(Not(BeNil()), "machine %s has no node", m.Metadata.Name)
+						Expect(hostNames).To(ContainElement(m.Status.NodeRef.Name),
+							"machine %s of cluster %s uses a node from another cluster", m.Metadata.Name, c.Name)
+					}
+				})
+			}(c)
+		}
+		wg.Wait()
+	})
+})
@@ -0,0 +1,131 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/condition"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+var _ = Describe("E2E - Test the reset feature", Label("reset"), func() {
+	// Files used to check that partitions are wiped
+	// NOTE: /usr/local is stored on the persistent partition
+	markerFiles := []string{
+		"/oem/reset-marker",
+		"/usr/local/reset-marker",
+	}
+
+	It("Reset one node in the cluster", func() {
+		var (
+			c        config.Cluster
+			hostName string
+			hostUID  string
+			machine  string
+		)
+
+		// NOTE: control plane placement is chosen by CAPI, so the node is found through its Machine
+		By("Choosing a worker node to reset", func() {
+			for _, cl := range cfg.Clusters() {
+				nodes, err := elemental.GetClusterNodes(k8s, cfg.ClusterNS, cl.Name, "!cluster.x-k8s.io/control-plane")
+				if errors.Is(err, elemental.ErrNotFound) {
+					continue
+				}
+				Expect(err).To(Not(HaveOccurred()))
+
+				c, hostName = cl, nodes[0]
+				break
+			}
+
+			// Resetting the only control plane node would destroy the cluster
+			if hostName == "" {
+				Skip("No worker node to reset")
+			}
+		})
+
+		client, _ := GetNodeInfo(hostName)
+		Expect(client).To(Not(BeNil()))
+
+		By("Adding marker files on OEM and persistent partitions of "+hostName, func() {
+			CheckSSH(client)
+
+			for _, f := range markerFiles {
+				_ = RunSSHWithRetry(client, "touch "+f)
+			}
+		})
+
+		By("Getting CAPI resources linked to "+hostName, func() {
+			h := &elemental.ElementalHost{}
+			err := k8s.Get(elemental.KindElementalHost, cfg.ClusterNS, hostName, h)
+			Expect(err).To(Not(HaveOccurred()))
+			hostUID = h.Metadata.UID
+			Expect(hostUID).To(Not(BeEmpty()))
+
+			m, err := elemental.GetInternalMachine(k8s, cfg.ClusterNS, hostName)
+			Expect(err).To(Not(HaveOccurred()))
+			machine = m.Metadata.Name
+		})
+
+		By("Deleting Machine and ElementalHost of "+hostName, func() {
+			_, err := kubectl.RunWithoutErr("delete", "machine",
+				"--namespace", cfg.ClusterNS, machine, "--wait=false")
+			Expect(err).To(Not(HaveOccurred()))
+
+			_, err = kubectl.RunWithoutErr("delete", "elementalhost",
+				"--namespace", cfg.ClusterNS, hostName, "--wait=false")
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		By("Checking that "+hostName+" reboots into recovery", func() {
+			Eventually(func() error {
+				_, err := client.RunSSH("[[ -f /run/cos/recovery_mode ]]")
+				return err
+			}, tools.SetTimeout(10*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+		})
+
+		By("Checking that "+hostName+" is registered again", func() {
+			// A new ElementalHost with the same name should be created
+			Eventually(func() string {
+				h := &elemental.ElementalHost{}
+				_ = k8s.Get(elemental.KindElementalHost, cfg.ClusterNS, hostName, h)
+				return h.Metadata.UID
+			}, tools.SetTimeout(15*time.Minute), 20*time.Second).Should(And(Not(BeEmpty()), Not(Equal(hostUID))))
+
+			WaitElementalResources(cfg.ClusterNS, condition.ElementalHost, hostName)
+		})
+
+		By("Checking that OEM and persistent partitions of "+hostName+" have been wiped", func() {
+			CheckSSH(client)
+
+			// Recovery mode should be left
+			_ = RunSSHWithRetry(client, "[[ ! -f /run/cos/recovery_mode ]]")
+
+			for _, f := range markerFiles {
+				_ = RunSSHWithRetry(client, "[[ ! -e "+f+" ]]")
+			}
+		})
+
+		By("Checking cluster state", func() {
+			WaitCAPICluster(cfg.ClusterNS, c.Name)
+		})
+	})
+})
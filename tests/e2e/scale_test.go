@@ -0,0 +1,254 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/condition"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/provisioning"
+	"github.com/rancher/elemental/tests/e2e/helpers/vm"
+)
+
+// Conditions of a host registered but not used by a machine
+var availableHost = []elemental.Condition{
+	{Type: "RegistrationReady", Status: "True"},
+	{Type: "InstallationReady", Status: "True"},
+}
+
+/*
+Wait for a host released by a cluster to be reset and available again
+  - @param ns Namespace where the host is registered
+  - @param before ElementalHost before the reset
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func WaitHostReset(ns string, before elemental.ElementalHost) {
+	hn := before.Metadata.Name
+
+	// A new ElementalHost with the same name should be created after the reset
+	h := &elemental.ElementalHost{}
+	Eventually(func() string {
+		h = &elemental.ElementalHost{}
+		_ = k8s.Get(elemental.KindElementalHost, ns, hn, h)
+		return h.Metadata.UID
+	}, tools.SetTimeout(15*time.Minute), 20*time.Second).Should(And(Not(BeEmpty()), Not(Equal(before.Metadata.UID))))
+
+	// The emulated TPM seed is kept by the host, so it should register with the same TPM
+	// NOTE: the seed is random with the shared ISO, it can change at each registration
+	if cfg.EmulateTPM && cfg.BootType != config.BootTypeISO && before.Spec.TPMHash != "" {
+		Expect(h.Spec.TPMHash).To(Equal(before.Spec.TPMHash), "TPM hash of %s changed after the reset", hn)
+	}
+
+	WaitElementalResources(ns, condition.ElementalHost, hn, availableHost...)
+}
+
+var _ = Describe("E2E - Scaling the cluster", Label("scale"), func() {
+	var wg sync.WaitGroup
+
+	BeforeEach(func() {
+		if cfg.OperatorType != config.OperatorTypeCAPI {
+			Skip("OPERATOR_TYPE is not " + config.OperatorTypeCAPI)
+		}
+		RequireVMRange()
+	})
+
+	// NOTE: the first cluster is scaled, with extra nodes added after the VM range
+	extraNodes := func() []string {
+		hostNames := []string{}
+		for index := cfg.VMNumbers + 1; index <= cfg.VMNumbers+cfg.ScaleNodes; index++ {
+			hostNames = append(hostNames, elemental.SetHostname(vmNameRoot, index))
+		}
+		return hostNames
+	}
+
+	// Ready nodes of the downstream cluster
+	readyNodes := func(c config.Cluster, downstream *elemental.Dynamic) []string {
+		list := &elemental.NodeList{}
+		if err := downstream.List(elemental.KindNode, "", "", list); err != nil {
+			GinkgoWriter.Printf("!! Cannot list nodes of %s !! %s\n", c.Name, err)
+			return nil
+		}
+
+		names := []string{}
+		for _, n := range list.Items {
+			for _, cond := range n.Status.Conditions {
+				if cond.Type == "Ready" && cond.Status == "True" {
+					names = append(names, n.Metadata.Name)
+				}
+			}
+		}
+		slices.Sort(names)
+
+		return names
+	}
+
+	// Number of ElementalMachines of the cluster
+	elementalMachines := func(c config.Cluster) int {
+		list := &elemental.ElementalMachineList{}
+		err := k8s.List(elemental.KindElementalMachine, cfg.ClusterNS, "cluster.x-k8s.io/cluster-name="+c.Name, list)
+		Expect(err).To(Not(HaveOccurred()))
+
+		return len(list.Items)
+	}
+
+	// Hosts before scaling, a new ElementalHost is created when a host is reset
+	hosts := func() map[string]elemental.ElementalHost {
+		hosts := map[string]elemental.ElementalHost{}
+		for index := cfg.VMIndex; index <= cfg.VMNumbers+cfg.ScaleNodes; index++ {
+			hostName := elemental.SetHostname(vmNameRoot, index)
+			h := elemental.ElementalHost{}
+			if err := k8s.Get(elemental.KindElementalHost, cfg.ClusterNS, hostName, &h); err == nil {
+				hosts[hostName] = h
+			}
+		}
+		return hosts
+	}
+
+	scale := func(c config.Cluster, rs string, delta int) {
+		downstream := elemental.NewDynamic(GetDownstreamKubeconfig(cfg.ClusterNS, c.Name))
+		replicas := GetReplicas(cfg.ClusterNS, rs)
+		before := readyNodes(c, downstream)
+		Expect(before).To(HaveLen(elementalMachines(c)))
+		hostsBefore := hosts()
+
+		var up []string
+		By("Scaling "+rs+" up by "+strconv.Itoa(delta), func() {
+			SetReplicas(cfg.ClusterNS, rs, replicas+delta)
+
+			Eventually(func() int {
+				return elementalMachines(c)
+			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(Equal(len(before) + delta))
+
+			Eventually(func() []string {
+				up = readyNodes(c, downstream)
+				return up
+			}, tools.SetTimeout(15*time.Minute), 20*time.Second).Should(HaveLen(len(before) + delta))
+			Expect(up).To(ContainElements(before))
+
+			WaitCAPICluster(cfg.ClusterNS, c.Name)
+		})
+
+		By("Scaling "+rs+" down", func() {
+			SetReplicas(cfg.ClusterNS, rs, replicas)
+
+			// ElementalMachines of the removed machines should be deleted
+			Eventually(func() int {
+				return elementalMachines(c)
+			}, tools.SetTimeout(10*time.Minute), 10*time.Second).Should(Equal(len(before)))
+
+			// The oldest control plane machines are removed, the node used as API server could be one of them
+			downstream = elemental.NewDynamic(GetDownstreamKubeconfig(cfg.ClusterNS, c.Name))
+
+			Eventually(func() []string {
+				return readyNodes(c, downstream)
+			}, tools.SetTimeout(10*time.Minute), 20*time.Second).Should(HaveLen(len(before)))
+
+			WaitCAPICluster(cfg.ClusterNS, c.Name)
+		})
+
+		By("Checking that released hosts are reset and available again", func() {
+			down := readyNodes(c, downstream)
+			released := slices.DeleteFunc(slices.Clone(up), func(n string) bool {
+				return slices.Contains(down, n)
+			})
+			Expect(released).To(HaveLen(delta))
+
+			for _, h := range released {
+				WaitHostReset(cfg.ClusterNS, hostsBefore[h])
+			}
+		})
+	}
+
+	It("Provision the extra nodes", func(ctx SpecContext) {
+		c := cfg.Clusters()[0]
+
+		// Same flow as the bootstrap, only the registration is needed
+		ac := NewAdmissionController()
+		for index := cfg.VMNumbers + 1; index <= cfg.VMNumbers+cfg.ScaleNodes; index++ {
+			hostName := elemental.SetHostname(vmNameRoot, index)
+			Expect(hostName).To(Not(BeEmpty()))
+
+			client, vmOptions := PrepareNode(hostName, index, c.Name)
+
+			err := ac.Acquire(ctx)
+			Expect(err).To(Not(HaveOccurred()))
+
+			wg.Add(1)
+			go func(h string, o *vm.Options, cl *tools.Client) {
+				defer wg.Done()
+				defer GinkgoRecover()
+
+				released := false
+				defer func() {
+					if !released {
+						ac.Release()
+					}
+				}()
+
+				InstallNode(o, cl, func(p provisioning.Phase) {
+					if p == provisioning.PhaseInstalled {
+						ac.Release()
+						released = true
+					}
+				})
+				StartNode(h, cl, nil)
+			}(hostName, vmOptions, client)
+		}
+		wg.Wait()
+
+		By("Checking that the extra hosts are available", func() {
+			for _, h := range extraNodes() {
+				WaitElementalResources(cfg.ClusterNS, condition.ElementalHost, h, availableHost...)
+			}
+		})
+	})
+
+	It("Scale the workers up and down", func() {
+		c := cfg.Clusters()[0]
+
+		out, err := kubectl.RunWithoutErr("get", "machinedeployment",
+			"--namespace", cfg.ClusterNS, "--selector", "cluster.x-k8s.io/cluster-name="+c.Name,
+			"-o", "jsonpath={.items[0].metadata.name}")
+		Expect(err).To(Not(HaveOccurred()))
+
+		scale(c, "machinedeployment/"+strings.TrimSpace(out), cfg.ScaleNodes)
+	})
+
+	It("Scale the control plane up and down", func() {
+		// etcd needs an odd number of members
+		if cfg.ScaleNodes < 2 {
+			Skip("SCALE_NODES should be at least 2 to scale the control plane")
+		}
+
+		c := cfg.Clusters()[0]
+
+		out, err := kubectl.RunWithoutErr("get", "cluster",
+			"--namespace", cfg.ClusterNS, c.Name,
+			"-o", "jsonpath={.spec.controlPlaneRef.kind}/{.spec.controlPlaneRef.name}")
+		Expect(err).To(Not(HaveOccurred()))
+
+		scale(c, strings.ToLower(strings.TrimSpace(out)), 2)
+	})
+})
@@ -15,7 +15,10 @@ limitations under the License.
 package e2e_test
 
 import (
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -27,49 +30,63 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
 	. "github.com/rancher-sandbox/qase-ginkgo"
+	"github.com/rancher/elemental/tests/e2e/helpers/admission"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+	"github.com/rancher/elemental/tests/e2e/helpers/clusterctl"
+	"github.com/rancher/elemental/tests/e2e/helpers/condition"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/diagnostics"
 	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"github.com/rancher/elemental/tests/e2e/helpers/network"
+	"github.com/rancher/elemental/tests/e2e/helpers/provisioning"
+	"github.com/rancher/elemental/tests/e2e/helpers/vm"
+	"github.com/rancher/elemental/tests/e2e/helpers/workspace"
+	"github.com/rancher/elemental/tests/qase/report"
 )
 
+// NOTE: files are relative to their workspace directory (assets, logs, provider or root)
 const (
-	capiRegistrationYaml = "../assets/capi_elementalRegistration.yaml"
-	clusterctlYaml       = "../assets/clusterctl.yaml"
-	ciTokenYaml          = "../assets/local-kubeconfig-token-skel.yaml"
-	elementalAPIYaml     = "../assets/elemental_capi_api.yaml"
-	emulateTPMYaml       = "../assets/emulateTPM.yaml"
-	httpSrv              = "http://192.168.122.1:8000"
-	installConfigYaml    = "../../install-config.yaml"
-	installVMScript      = "../scripts/install-vm"
-	numberOfNodesMax     = 30
-	userName             = "root"
-	userPassword         = "r0s@pwd1"
-	vmNameRoot           = "node"
+	appYaml                 = "hello-world_app.yaml"
+	capiRegistrationYaml    = "capi_elementalRegistration.yaml"
+	clusterctlYaml          = "clusterctl.yaml"
+	ciTokenYaml             = "local-kubeconfig-token-skel.yaml"
+	diagnosticsDir          = "diagnostics"
+	elementalAPIYaml        = "elemental_capi_api.yaml"
+	emulateTPMYaml          = "emulateTPM.yaml"
+	httpSrv                 = "http://192.168.122.1:8000"
+	installConfigYaml       = "install-config.yaml"
+	ipxeBinary              = "ipxe-x86_64.efi"
+	ipxeLink                = "ipxe.efi"
+	isoImages               = "iso/elemental-*.iso"
+	machineRegistrationYaml = "machineRegistration.yaml"
+	osUpgradeYaml           = "upgrade_managedOSImage.yaml"
+	ovmfCode                = "/usr/share/qemu/ovmf-x86_64-smm-suse-code.bin"
+	ovmfVarsTemplate        = "ovmf-template-vars.fd"
+	provisioningReportJSON  = "provisioning-report.json"
+	provisioningReportJUnit = "provisioning-report.xml"
+	rawImages               = "elemental-*.raw"
+	roleLabel               = "role"
+	selectorYaml            = "selector.yaml"
+	userName                = "root"
+	userPassword            = "r0s@pwd1"
+	vmDiskSize              = 30
+	vmNameRoot              = "node"
 )
 
 var (
-	bootstrapProvider    string
-	clusterName          string
-	clusterNS            string
-	clusterType          string
-	clusterYaml          string
-	controlPlaneProvider string
-	elementalAPIEndpoint string
-	elementalSupport     string
-	emulateTPM           bool
-	isoBoot              bool
-	k8sUpstreamVersion   string
-	k8sDownstreamVersion string
-	netDefaultFileName   string
-	numberOfVMs          int
-	operatorRepo         string
-	operatorType         string
-	registrationYaml     string
-	testCaseID           int64
-	testType             string
-	usedNodes            int
-	vmIndex              int
-	vmName               string
+	cfg                *config.SuiteConfig
+	clusterYaml        string
+	hypervisor         vm.Hypervisor
+	k8s                *elemental.Dynamic
+	netDefaultFileName string
+	registrationYaml   string
+	testCaseID         int64
+	ws                 *workspace.Workspace
 )
 
+// Workspace directories can be set with flags, environment variables are used as defaults
+var wsOptions = workspace.BindFlags(flag.CommandLine)
+
 /*
 Wait for cluster to be in a stable state
   - @param ns Namespace where the cluster is deployed
@@ -77,140 +94,79 @@ Wait for cluster to be in a stable state
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
 func WaitCAPICluster(ns, cn string) {
-	type state struct {
-		conditionStatus string
-		conditionType   string
-	}
-
-	// List of conditions to check
-	states := []state{
-		{
-			conditionStatus: "true",
-			conditionType:   "controlPlaneReady",
-		},
-		{
-			conditionStatus: "true",
-			conditionType:   "infrastructureReady",
-		},
-	}
-
-	// Check that all needed conditions are in the good state
-	for _, s := range states {
-		counter := 0
-
-		Eventually(func() string {
-			status, _ := kubectl.RunWithoutErr("get", "cluster",
-				"--namespace", ns, cn,
-				"-o", "jsonpath={.status."+s.conditionType+"}")
-
-			if status != s.conditionStatus {
-				// Show the status in case of issue, easier to debug (but log after 10 different issues)
-				// NOTE: it's not perfect but it's mainly a way to inform that the cluster took time to came up
-				counter++
-				if counter > 10 {
-					GinkgoWriter.Printf("!! Cluster status issue !! %s is %s instead of %s\n",
-						s.conditionType, status, s.conditionStatus)
-
-					// Reset counter
-					counter = 0
-				}
-			}
-
-			return status
-		}, tools.SetTimeout(2*time.Duration(usedNodes)*time.Minute), 10*time.Second).Should(Equal(s.conditionStatus))
-	}
+	WaitElementalResources(ns, condition.Cluster, cn)
 }
 
 /*
-Wait for elemental resource to be in a ready state
+Wait for Rancher provisioning cluster to be in a stable state
   - @param ns Namespace where the cluster is deployed
-  - @param er Elemental resource type
-  - @param rs Elemental resource name
+  - @param cn Cluster resource name
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
-func WaitElementalResources(ns, er, rs string) {
-	type state struct {
-		conditionStatus string
-		conditionType   string
-	}
+func WaitRancherCluster(ns, cn string) {
+	Eventually(func() string {
+		state, _ := elemental.GetClusterState(k8s, ns, cn, "Ready")
+		return state
+	}, tools.SetTimeout(2*time.Duration(cfg.UsedNodes())*time.Minute), 10*time.Second).Should(Equal("True"))
+}
 
-	// List of conditions to check
-	elementalHostStates := []state{
-		{
-			conditionStatus: "True",
-			conditionType:   "RegistrationReady",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "InstallationReady",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "BootstrapReady",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "Ready",
-		},
-	}
+/*
+Set the role of the MachineInventories of a cluster, used by its MachineInventorySelectorTemplates
+NOTE: the first nodes are used for the control plane, nodes after the workers are not selected
+  - @param ns Namespace where the cluster is deployed
+  - @param c Cluster using the nodes
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func SetMachineInventoryRoles(ns string, c config.Cluster) {
+	for index := c.VMIndex; index < c.VMIndex+c.Machines() && index <= c.VMNumbers; index++ {
+		role := "worker"
+		if index < c.VMIndex+c.ControlPlanes {
+			role = "master"
+		}
 
-	// List of conditions to check
-	elementalMachineStates := []state{
-		{
-			conditionStatus: "True",
-			conditionType:   "AssociationReady",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "HostReady",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "ProviderIDReady",
-		},
-		{
-			conditionStatus: "True",
-			conditionType:   "Ready",
-		},
+		// MachineInventories are named like the nodes
+		hostName := elemental.SetHostname(vmNameRoot, index)
+		Expect(hostName).To(Not(BeEmpty()))
+		err := elemental.SetMachineInventoryLabel(k8s, ns, hostName, roleLabel, role)
+		Expect(err).To(Not(HaveOccurred()))
 	}
+}
 
-	// Check that all needed conditions are in the good state
-	var statesCheck []state
-
-	switch er {
-	case "elementalhost":
-		statesCheck = elementalHostStates
-	case "elementalmachine":
-		statesCheck = elementalMachineStates
+/*
+Get the CAPI providers used by the clusters
+  - @param elementalVersion Version of the elemental infrastructure provider
+  - @param rke2Version Version of the bootstrap and control plane providers
+  - @returns The providers, to use with clusterctl
+*/
+func CAPIProviders(elementalVersion, rke2Version string) []clusterctl.Provider {
+	return []clusterctl.Provider{
+		{Name: "elemental", Namespace: "elemental-system", Type: clusterctl.TypeInfrastructure, Version: elementalVersion, Flavor: cfg.BootstrapProvider},
+		{Name: cfg.BootstrapProvider, Namespace: cfg.BootstrapProvider + "-bootstrap-system", Type: clusterctl.TypeBootstrap, Version: rke2Version},
+		{Name: cfg.ControlPlaneProvider, Namespace: cfg.ControlPlaneProvider + "-control-plane-system", Type: clusterctl.TypeControlPlane, Version: rke2Version},
 	}
+}
 
-	// Check that all needed conditions are in the good state
-	for _, s := range statesCheck {
-		CheckCondition(ns, er, rs, s.conditionType, s.conditionStatus)
-	}
+/*
+Check that the VM range used by the spec is set
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func RequireVMRange() {
+	err := cfg.CheckVMRange()
+	Expect(err).To(Not(HaveOccurred()))
 }
 
 /*
-Check that condition is in the expected state
-  - @param ns Namespace where the cluster is deployed
-  - @param er Elemental resource type
-  - @param rs Elemental resource name
-  - @param ct Condition type
-  - @param cs Condition status
+Wait for elemental resource to be in a ready state
+  - @param ns Namespace where the resource is deployed
+  - @param kind Kind of the resource
+  - @param rs Resource name
+  - @param conditions Conditions to wait for, default ones of the kind if empty
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
-func CheckCondition(ns, er, rs, ct, cs string) {
-	Eventually(func() string {
-		status, _ := kubectl.RunWithoutErr("get", er,
-			"--namespace", ns, rs,
-			"-o", "jsonpath={.status.conditions[?(@.type==\""+ct+"\")].status}")
-		if status != cs {
-			// Show the status in case of issue, easier to debug
-			GinkgoWriter.Printf("!! %s status issue !! %s is %s instead of %s\n",
-				er, ct, status, cs)
-		}
-		return status
-	}, tools.SetTimeout(2*time.Duration(usedNodes)*time.Minute), 20*time.Second).Should(Equal(cs))
+func WaitElementalResources(ns string, kind condition.GVK, rs string, conditions ...elemental.Condition) {
+	w := condition.NewWaiter(condition.NewDynamic(k8s), tools.SetTimeout(2*time.Duration(cfg.UsedNodes())*time.Minute))
+	err := w.Wait(kind, ns, rs, conditions...)
+	Expect(err).To(Not(HaveOccurred()))
 }
 
 /*
@@ -223,7 +179,7 @@ Check that Registration resource has been correctly created
 func CheckCreatedRegistration(ns, rn string) {
 	Eventually(func() string {
 		registration := "MachineRegistration"
-		if operatorType == "capi" {
+		if cfg.OperatorType == config.OperatorTypeCAPI {
 			registration = "ElementalRegistration"
 		}
 		out, _ := kubectl.RunWithoutErr("get", registration,
@@ -245,6 +201,62 @@ func CheckSSH(cl *tools.Client) {
 	}, tools.SetTimeout(10*time.Minute), 5*time.Second).Should(Equal("SSH_OK"))
 }
 
+/*
+Write the kubeconfig of a downstream cluster in a temporary file
+NOTE: the API server address is replaced by the IP of a control plane node, to be reachable from the host
+  - @param ns Namespace where the cluster is deployed
+  - @param cn Cluster resource name
+  - @returns Path of the kubeconfig file, removed at the end of the spec
+*/
+func GetDownstreamKubeconfig(ns, cn string) string {
+	var file string
+
+	// Secret and control plane nodes are set by CAPI once the control plane is initialized
+	Eventually(func() error {
+		var err error
+		file, err = GetDownstreamKubeconfigE(ns, cn)
+		return err
+	}, tools.SetTimeout(4*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+
+	return file
+}
+
+/*
+Write the kubeconfig of a downstream cluster in a temporary file, to be used inside polling functions
+  - @param ns Namespace where the cluster is deployed
+  - @param cn Cluster resource name
+  - @returns Path of the kubeconfig file, removed at the end of the spec, or an error
+*/
+func GetDownstreamKubeconfigE(ns, cn string) (string, error) {
+	data, err := elemental.GetClusterKubeconfig(k8s, ns, cn)
+	if err != nil {
+		return "", err
+	}
+
+	nodes, err := elemental.GetControlPlaneNodes(k8s, ns, cn)
+	if err != nil {
+		return "", err
+	}
+
+	netData, err := rancher.GetHostNetConfig(".*name=\""+nodes[0]+"\".*", netDefaultFileName)
+	if err != nil {
+		return "", err
+	}
+
+	data, err = elemental.SetKubeconfigServer(data, netData.IP)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := tools.CreateTemp(cn + "-kubeconfig")
+	if err != nil {
+		return "", err
+	}
+	DeferCleanup(os.Remove, file)
+
+	return file, os.WriteFile(file, data, 0600)
+}
+
 /*
 Get Elemental node information
   - @param hn Node hostname
@@ -278,6 +290,73 @@ func GetNodeIP(hn string) string {
 	return data.IP
 }
 
+/*
+Get the options to use to create an Elemental node VM
+  - @param hn Node hostname
+  - @param mac MAC address of the node
+  - @returns VM options, the function will fail through Ginkgo in case of issue
+*/
+func GetVMOptions(hn, mac string) *vm.Options {
+	// Disk is stored in the suite directory
+	o := &vm.Options{
+		Name:     hn,
+		MAC:      mac,
+		BootType: vm.BootType(cfg.BootType),
+		Disk:     filepath.Join(ws.Suite, hn, hn+".img"),
+		DiskSize: vmDiskSize,
+		Memory:   cfg.VMMemory,
+		CPU:      cfg.VMCPU,
+		// Don't configure TPM if software emulation is used
+		TPM: !cfg.EmulateTPM,
+		Firmware: &vm.Firmware{
+			Code:         ovmfCode,
+			VarsTemplate: ws.Asset(ovmfVarsTemplate),
+			SecureBoot:   true,
+		},
+		ConsoleLogFile: ws.Log("bootstrap_" + hn + ".log"),
+	}
+
+	// Use hugepages only if they are configured on the host
+	if cfg.UseHugepages {
+		nr, err := vm.ConfigureHugepages(cfg.HostMemoryReserved)
+		Expect(err).To(Not(HaveOccurred()))
+		o.Hugepages = nr > 0
+	}
+
+	switch o.BootType {
+	case vm.BootISO:
+		o.Media = findMedia(ws.ProviderFile(isoImages))
+		o.NoReboot = true
+	case vm.BootRaw:
+		o.Media = findMedia(ws.RootFile(rawImages))
+	case vm.BootPXE:
+		o.NoReboot = true
+		// Expose iPXE binary through the HTTP server, but only if it doesn't exist
+		if _, err := os.Lstat(ws.RootFile(ipxeLink)); err != nil {
+			err = os.Symlink(ws.Asset(ipxeBinary), ws.RootFile(ipxeLink))
+			Expect(err).To(Not(HaveOccurred()))
+		}
+	}
+
+	return o
+}
+
+/*
+Find installation media
+  - @param pattern Glob pattern of the media
+  - @returns Absolute path of the first media found, the function will fail through Ginkgo in case of issue
+*/
+func findMedia(pattern string) string {
+	files, err := filepath.Glob(pattern)
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(files).To(Not(BeEmpty()), "File %s not found!", pattern)
+
+	media, err := filepath.Abs(files[0])
+	Expect(err).To(Not(HaveOccurred()))
+
+	return media
+}
+
 /*
 Execute RunHelmBinaryWithCustomErr within a loop with timeout
   - @param s options to pass to RunHelmBinaryWithCustomErr command
@@ -289,6 +368,178 @@ func RunHelmCmdWithRetry(s ...string) {
 	}, tools.SetTimeout(2*time.Minute), 20*time.Second).Should(Not(HaveOccurred()))
 }
 
+/*
+Create the admission controller used to start the nodes
+  - @returns Pointer to the Controller structure, configured from the suite configuration
+*/
+func NewAdmissionController() *admission.Controller {
+	ac := admission.New(cfg.MaxInFlight)
+	ac.MaxLoad = cfg.MaxHostLoad
+	ac.MinMemory = cfg.MinHostMemory
+
+	return ac
+}
+
+/*
+Check if each node needs its own install config
+  - @returns True if nodes need their own emulated TPM seed or cluster registration
+*/
+func PerNodeConfig() bool {
+	return cfg.EmulateTPM || cfg.TestType == config.TestTypeMulti
+}
+
+/*
+Add a node in the network configuration and get its VM options
+  - @param hn Node hostname
+  - @param index Index of the node
+  - @param cn Cluster resource name where the node will be added
+  - @returns Client to access the node and options of its VM
+*/
+func PrepareNode(hn string, index int, cn string) (*tools.Client, *vm.Options) {
+	// Add node in network configuration
+	err := rancher.AddNode(netDefaultFileName, hn, index)
+	Expect(err).To(Not(HaveOccurred()))
+
+	// Get generated MAC address
+	client, macAdrs := GetNodeInfo(hn)
+	Expect(client).To(Not(BeNil()))
+	Expect(macAdrs).To(Not(BeEmpty()))
+
+	if PerNodeConfig() && cfg.BootType != config.BootTypeISO {
+		WriteNodeInstallConfig(hn, macAdrs, ClusterInstallConfig(cn))
+	}
+
+	return client, GetVMOptions(hn, macAdrs)
+}
+
+/*
+Install a node and halt it once installed
+  - @param o Options of the VM
+  - @param cl Client (node) informations
+  - @param record Function called when a provisioning phase is reached, can be nil
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func InstallNode(o *vm.Options, cl *tools.Client, record func(provisioning.Phase)) {
+	h := o.Name
+	if record == nil {
+		record = func(provisioning.Phase) {}
+	}
+
+	By("Installing node "+h, func() {
+		// Execute node deployment in parallel
+		err := hypervisor.Define(o)
+		Expect(err).To(Not(HaveOccurred()))
+		err = hypervisor.Start(h)
+		Expect(err).To(Not(HaveOccurred()))
+		record(provisioning.PhaseVMCreated)
+	})
+
+	By("Collecting logs on "+h, func() {
+		// Wait for SSH to be available
+		// NOTE: this also checks that the root password was correctly set by cloud-config
+		CheckSSH(cl)
+
+		// A little bit dirty but this is temporary to keep compatibility with older Stable versions
+		installCheck := "(journalctl --no-pager -u elemental-agent-install ; journalctl --no-pager -u elemental-agent-install.service) | grep -Eiq 'Installation successful'"
+		if cfg.OperatorType == config.OperatorTypeVanilla {
+			// Installation is done by elemental-register with the vanilla operator
+			installCheck = "journalctl --no-pager -u elemental-register-install.service | grep -Eiq 'elemental install completed|Installation successful'"
+		}
+
+		// Check that the installation is completed before halting the VM
+		Eventually(func() error {
+			_, err := cl.RunSSH(installCheck)
+			// Save journalctl logs to analyze issues if needed
+			out, logErr := cl.RunSSH("journalctl --no-pager")
+			Expect(logErr).To(Not(HaveOccurred()))
+			logErr = os.WriteFile(ws.Log(h+"-journalctl-installation.log"), []byte(out), 0644)
+			Expect(logErr).To(Not(HaveOccurred()))
+			return err
+		}, tools.SetTimeout(8*time.Minute), 20*time.Second).Should(Not(HaveOccurred()))
+		record(provisioning.PhaseInstalled)
+
+		// Halt the VM
+		_ = RunSSHWithRetry(cl, "setsid -f init 0")
+
+		// Make sure VM status is equal to shut-off
+		Eventually(func() vm.State {
+			state, err := hypervisor.State(h)
+			if err != nil {
+				GinkgoWriter.Printf("!! Cannot get %s state !! %s\n", h, err)
+			}
+			return state
+		}, tools.SetTimeout(5*time.Minute), 5*time.Second).Should(Equal(vm.StateShutOff))
+		record(provisioning.PhaseShutOff)
+	})
+}
+
+/*
+Restart an installed node to add it in the cluster
+  - @param hn Node hostname
+  - @param cl Client (node) informations
+  - @param record Function called when a provisioning phase is reached, can be nil
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func StartNode(hn string, cl *tools.Client, record func(provisioning.Phase)) {
+	if record == nil {
+		record = func(provisioning.Phase) {}
+	}
+
+	// Restart the node(s)
+	By("Restarting "+hn+" to add it in the cluster", func() {
+		err := hypervisor.Start(hn)
+		Expect(err).To(Not(HaveOccurred()))
+		record(provisioning.PhaseRestarted)
+	})
+
+	By("Checking "+hn+" SSH connection", func() {
+		CheckSSH(cl)
+		record(provisioning.PhaseSSHUp)
+	})
+
+	By("Checking that TPM is correctly configured on "+hn, func() {
+		testValue := "-c"
+		if cfg.EmulateTPM {
+			testValue = "! -e"
+		}
+		_ = RunSSHWithRetry(cl, "[[ "+testValue+" /dev/tpm0 ]]")
+	})
+
+	By("Checking OS version on "+hn, func() {
+		out := RunSSHWithRetry(cl, "cat /etc/os-release")
+		GinkgoWriter.Printf("OS Version on %s:\n%s\n", hn, out)
+	})
+}
+
+/*
+Get the number of replicas of a resource
+  - @param ns Namespace of the resource
+  - @param rs Resource as kind/name (MachineDeployment, control plane...)
+  - @returns The number of replicas
+*/
+func GetReplicas(ns, rs string) int {
+	out, err := kubectl.RunWithoutErr("get", rs, "--namespace", ns, "-o", "jsonpath={.spec.replicas}")
+	Expect(err).To(Not(HaveOccurred()))
+
+	replicas, err := strconv.Atoi(strings.TrimSpace(out))
+	Expect(err).To(Not(HaveOccurred()))
+
+	return replicas
+}
+
+/*
+Set the number of replicas of a resource
+  - @param ns Namespace of the resource
+  - @param rs Resource as kind/name (MachineDeployment, control plane...)
+  - @param replicas Number of replicas to set
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func SetReplicas(ns, rs string, replicas int) {
+	_, err := kubectl.RunWithoutErr("patch", rs, "--namespace", ns, "--type", "merge",
+		"-p", fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	Expect(err).To(Not(HaveOccurred()))
+}
+
 /*
 Execute SSH command with retry
   - @param cl Client (node) informations
@@ -307,6 +558,41 @@ func RunSSHWithRetry(cl *tools.Client, cmd string) string {
 	return out
 }
 
+/*
+Get the install config file of a cluster
+  - @param cn Cluster resource name
+  - @returns Path of the install config file, shared by all the clusters if only one is used
+*/
+func ClusterInstallConfig(cn string) string {
+	if cfg.TestType != config.TestTypeMulti {
+		return ws.RootFile(installConfigYaml)
+	}
+
+	return ws.RootFile(strings.TrimSuffix(installConfigYaml, ".yaml") + "-" + cn + ".yaml")
+}
+
+/*
+Write the install config of a node, with its own emulated TPM seed if needed
+  - @param hn Node hostname
+  - @param mac Node MAC address
+  - @param file Install config file of the cluster where the node is added
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func WriteNodeInstallConfig(hn, mac, file string) {
+	data, err := os.ReadFile(file)
+	Expect(err).To(Not(HaveOccurred()))
+
+	if cfg.EmulateTPM {
+		// Seed -1 from the registration is random, use a stable one per node
+		overlay := fmt.Sprintf("elemental:\n  registration:\n    emulate-tpm: true\n    emulated-tpm-seed: %d\n", elemental.TPMSeed(hn))
+		data, err = assets.Merge(data, []byte(overlay))
+		Expect(err).To(Not(HaveOccurred()))
+	}
+
+	err = os.WriteFile(ws.RootFile(network.NodeConfigFile(mac)), data, 0644)
+	Expect(err).To(Not(HaveOccurred()))
+}
+
 func FailWithReport(message string, callerSkip ...int) {
 	// Ensures the correct line numbers are reported
 	Fail(message, callerSkip[0]+1)
@@ -317,81 +603,85 @@ func TestE2E(t *testing.T) {
 	RunSpecs(t, "Elemental End-To-End Test Suite")
 }
 
-// Use to modify yaml templates
-type YamlPattern struct {
-	key   string
-	value string
-}
-
 var _ = BeforeSuite(func() {
-	bootTypeString := os.Getenv("BOOT_TYPE")
-	bootstrapProvider = os.Getenv("BOOTSTRAP_PROVIDER")
-	clusterName = os.Getenv("CLUSTER_NAME")
-	clusterNS = os.Getenv("CLUSTER_NS")
-	clusterType = os.Getenv("CLUSTER_TYPE")
-	controlPlaneProvider = os.Getenv("CONTROL_PLANE_PROVIDER")
-	elementalAPIEndpoint = os.Getenv("ELEMENTAL_API_ENDPOINT")
-	elementalSupport = os.Getenv("ELEMENTAL_SUPPORT")
-	eTPM := os.Getenv("EMULATE_TPM")
-	index := os.Getenv("VM_INDEX")
-	k8sDownstreamVersion = os.Getenv("K8S_DOWNSTREAM_VERSION")
-	k8sUpstreamVersion = os.Getenv("K8S_UPSTREAM_VERSION")
-	number := os.Getenv("VM_NUMBERS")
-	operatorRepo = os.Getenv("OPERATOR_REPO")
-	operatorType = os.Getenv("OPERATOR_TYPE")
-	testType = os.Getenv("TEST_TYPE")
-
-	// Only if VM_INDEX is set
-	if index != "" {
-		var err error
-		vmIndex, err = strconv.Atoi(index)
-		Expect(err).To(Not(HaveOccurred()))
+	var err error
 
-		// Set default hostname
-		vmName = elemental.SetHostname(vmNameRoot, vmIndex)
-	} else {
-		// Default value for vmIndex
-		vmIndex = 0
+	// Load and validate the suite configuration
+	cfg, err = config.Load(os.Getenv(config.FileEnv))
+	Expect(err).To(Not(HaveOccurred()))
+
+	// Show the effective configuration, easier to debug
+	GinkgoWriter.Printf("Suite configuration:\n%s", cfg)
+
+	// Resolve the workspace once, paths don't depend on the current directory anymore
+	ws, err = workspace.Resolve(*wsOptions)
+	Expect(err).To(Not(HaveOccurred()))
+
+	// VMs are managed through libvirt
+	hypervisor, err = vm.NewLibvirt(vm.SystemURI)
+	Expect(err).To(Not(HaveOccurred()))
+
+	// Kubernetes resources are read through the API, with the default kubeconfig
+	k8s = elemental.NewDynamic("")
+
+	switch cfg.TestType {
+	default:
+		// Default cluster support
+		clusterYaml = ws.Asset("cluster.yaml")
+		netDefaultFileName = ws.Asset("net-default-capi.xml")
+		registrationYaml = ws.Asset(capiRegistrationYaml)
 	}
 
-	// Only if VM_NUMBER is set
-	if number != "" {
-		var err error
-		numberOfVMs, err = strconv.Atoi(number)
-		Expect(err).To(Not(HaveOccurred()))
-	} else {
-		// By default set to vmIndex
-		numberOfVMs = vmIndex
+	if cfg.OperatorType == config.OperatorTypeVanilla {
+		registrationYaml = ws.Asset(machineRegistrationYaml)
 	}
 
-	// Set number of "used" nodes
-	// NOTE: could be the number added nodes or the number of nodes to use/upgrade
-	usedNodes = (numberOfVMs - vmIndex) + 1
+	// Start HTTP server
+	tools.HTTPShare(ws.Root, ":8000")
+})
 
-	// Force correct value for emulateTPM
-	switch eTPM {
-	case "true":
-		emulateTPM = true
-	default:
-		emulateTPM = false
+/*
+Collect a diagnostics bundle of the cluster and the nodes
+  - @param name Name of the bundle
+  - @returns Nothing, errors are only logged as this is used for debugging
+*/
+func CollectDiagnostics(name string) {
+	c := diagnostics.NewCollector(ws.Log(diagnosticsDir))
+	c.Hypervisor = hypervisor
+
+	// Nodes without network configuration are not created yet
+	for index := cfg.VMIndex; index <= cfg.VMNumbers; index++ {
+		hostName := elemental.SetHostname(vmNameRoot, index)
+		data, err := rancher.GetHostNetConfig(".*name=\""+hostName+"\".*", netDefaultFileName)
+		if err != nil || data.IP == "" {
+			continue
+		}
+		c.Nodes[hostName] = &tools.Client{
+			Host:     data.IP + ":22",
+			Username: userName,
+			Password: userPassword,
+		}
 	}
 
-	// Define boot type
-	switch bootTypeString {
-	case "iso":
-		isoBoot = true
+	tarball, err := c.Collect(name)
+	if err != nil {
+		GinkgoWriter.Printf("!! Diagnostics are incomplete !! %s\n", err)
 	}
+	if tarball != "" {
+		AddReportEntry("Diagnostics bundle", tarball)
+	}
+}
 
-	switch testType {
-	default:
-		// Default cluster support
-		clusterYaml = "../assets/cluster.yaml"
-		netDefaultFileName = "../assets/net-default-capi.xml"
-		registrationYaml = "../assets/capi_elementalRegistration.yaml"
+var _ = AfterEach(func() {
+	// Keep the case ID in the reports, to be able to upload the results later
+	if testCaseID > 0 {
+		AddReportEntry(report.CaseIDEntry, testCaseID, ReportEntryVisibilityFailureOrVerbose)
 	}
 
-	// Start HTTP server
-	tools.HTTPShare("../..", ":8000")
+	// Gather everything needed to debug the failure, nothing is downloaded
+	if CurrentSpecReport().Failed() && cfg != nil {
+		CollectDiagnostics(CurrentSpecReport().FullText())
+	}
 })
 
 var _ = ReportBeforeEach(func(report SpecReport) {
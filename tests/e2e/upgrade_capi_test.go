@@ -0,0 +1,219 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/rancher"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/clusterctl"
+	"github.com/rancher/elemental/tests/e2e/helpers/condition"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+var _ = Describe("E2E - Upgrading CAPI providers", Label("upgrade-capi"), func() {
+	// Create kubectl context
+	// Default timeout is too small, so New() cannot be used
+	k := &kubectl.Kubectl{
+		Namespace:    "",
+		PollTimeout:  tools.SetTimeout(300 * time.Second),
+		PollInterval: 500 * time.Millisecond,
+	}
+
+	BeforeEach(func() {
+		if cfg.OperatorType != config.OperatorTypeCAPI {
+			Skip("OPERATOR_TYPE is not " + config.OperatorTypeCAPI)
+		}
+		if cfg.CAPIElementalVersion == "" {
+			Skip("CAPI_ELEMENTAL_VERSION is not set, the compiled provider is already installed")
+		}
+	})
+
+	It("Upgrade the providers while the cluster is running", func(ctx SpecContext) {
+		var (
+			failures []string
+			mutex    sync.Mutex
+			wg       sync.WaitGroup
+		)
+
+		// Conditions of the resources before the upgrade, indexed by name
+		hosts := map[string][]elemental.Condition{}
+		machines := map[string][]elemental.Condition{}
+
+		// Number of checks done by the monitor, indexed by cluster name
+		polls := map[string]*atomic.Int64{}
+
+		// Only the status is compared, reasons and messages can change with the provider
+		statuses := func(conditions []elemental.Condition) []elemental.Condition {
+			list := make([]elemental.Condition, 0, len(conditions))
+			for _, c := range conditions {
+				list = append(list, elemental.Condition{Type: c.Type, Status: c.Status})
+			}
+			return list
+		}
+
+		providers := CAPIProviders(cfg.CAPIElementalUpgradeVersion, cfg.CAPIRKE2UpgradeVersion)
+
+		By("Adding the compiled elemental provider in the local repository", func() {
+			// Generated by the build of the provider
+			err := clusterctl.AddProvider(ws.Clusterctl, providers[0], ws.ProviderFile("infrastructure-elemental/v0.0.0"), "v1beta1")
+			Expect(err).To(Not(HaveOccurred()))
+
+			for _, p := range providers {
+				err := p.Check(ws.Clusterctl)
+				Expect(err).To(Not(HaveOccurred()), "populate the local repository with make e2e-install-clusterctl-repository")
+			}
+		})
+
+		By("Getting the elemental resources of the cluster(s)", func() {
+			hostList := &elemental.ElementalHostList{}
+			err := k8s.List(elemental.KindElementalHost, cfg.ClusterNS, "", hostList)
+			Expect(err).To(Not(HaveOccurred()))
+			for _, h := range hostList.Items {
+				hosts[h.Metadata.Name] = statuses(h.Status.Conditions)
+			}
+
+			machineList := &elemental.ElementalMachineList{}
+			err = k8s.List(elemental.KindElementalMachine, cfg.ClusterNS, "", machineList)
+			Expect(err).To(Not(HaveOccurred()))
+			for _, m := range machineList.Items {
+				machines[m.Metadata.Name] = statuses(m.Status.Conditions)
+			}
+
+			Expect(machines).To(Not(BeEmpty()))
+		})
+
+		By("Monitoring the workload cluster(s) during the upgrade", func() {
+			monitorCtx, cancel := context.WithCancel(ctx)
+			DeferCleanup(func() {
+				cancel()
+				wg.Wait()
+			})
+
+			for _, c := range cfg.Clusters() {
+				// Downstream cluster is accessed through the kubeconfig generated by CAPI
+				downstream := elemental.NewDynamic(GetDownstreamKubeconfig(cfg.ClusterNS, c.Name))
+
+				n := &atomic.Int64{}
+				polls[c.Name] = n
+
+				wg.Add(1)
+				go func(cn string, n *atomic.Int64) {
+					defer wg.Done()
+					defer GinkgoRecover()
+
+					for {
+						select {
+						case <-monitorCtx.Done():
+							return
+						case <-time.After(10 * time.Second):
+						}
+
+						if err := downstream.List(elemental.KindNode, "", "", &elemental.NodeList{}); err != nil {
+							mutex.Lock()
+							failures = append(failures, time.Now().Format(time.RFC3339)+" "+cn+": "+err.Error())
+							mutex.Unlock()
+						}
+						n.Add(1)
+					}
+				}(c.Name, n)
+			}
+		})
+
+		By("Upgrading the providers with clusterctl", func() {
+			args := []string{"--v", "4", "upgrade", "apply"}
+			for _, p := range providers {
+				args = append(args, p.Flag(), p.UpgradeRef())
+			}
+
+			out, err := exec.Command("/usr/local/bin/clusterctl", args...).CombinedOutput()
+			// Show command output, easier to debug
+			GinkgoWriter.Printf("%s\n", string(out))
+			Expect(err).To(Not(HaveOccurred()))
+
+			// Wait for all pods to be restarted
+			checkList := [][]string{
+				{"capi-system", "control-plane=controller-manager"},
+				{"elemental-system", "control-plane=controller-manager"},
+				{cfg.BootstrapProvider + "-bootstrap-system", "cluster.x-k8s.io/provider=bootstrap-" + cfg.BootstrapProvider},
+				{cfg.ControlPlaneProvider + "-control-plane-system", "cluster.x-k8s.io/provider=control-plane-" + cfg.ControlPlaneProvider},
+			}
+			Eventually(func() error {
+				return rancher.CheckPod(k, checkList)
+			}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(BeNil())
+		})
+
+		By("Checking the providers versions", func() {
+			for _, p := range providers {
+				Eventually(func() string {
+					out, _ := kubectl.RunWithoutErr("get", "providers.clusterctl.cluster.x-k8s.io",
+						"--namespace", p.Namespace, p.Label(),
+						"-o", "jsonpath={.version}")
+					return strings.TrimSpace(out)
+				}, tools.SetTimeout(2*time.Minute), 10*time.Second).Should(Equal(p.Version))
+			}
+		})
+
+		By("Checking that the elemental resources keep their conditions", func() {
+			for h, conditions := range hosts {
+				WaitElementalResources(cfg.ClusterNS, condition.ElementalHost, h, conditions...)
+			}
+			for m, conditions := range machines {
+				WaitElementalResources(cfg.ClusterNS, condition.ElementalMachine, m, conditions...)
+			}
+		})
+
+		By("Checking that the workload cluster(s) stayed available", func() {
+			for _, c := range cfg.Clusters() {
+				WaitCAPICluster(cfg.ClusterNS, c.Name)
+			}
+
+			// All the controllers have to be available again
+			for _, ns := range []string{
+				"capi-system",
+				"elemental-system",
+				cfg.BootstrapProvider + "-bootstrap-system",
+				cfg.ControlPlaneProvider + "-control-plane-system",
+			} {
+				Eventually(func() error {
+					_, err := kubectl.RunWithoutErr("wait", "--for=condition=Available", "deployment", "--all",
+						"--namespace", ns, "--timeout=30s")
+					return err
+				}, tools.SetTimeout(4*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+			}
+
+			// Let the monitor check each cluster once more after the upgrade
+			for cn, p := range polls {
+				done := p.Load()
+				Eventually(p.Load, tools.SetTimeout(2*time.Minute), 5*time.Second).
+					Should(BeNumerically(">", done), "no check of cluster %s after the upgrade", cn)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			Expect(failures).To(BeEmpty(), "workload cluster(s) not available during the upgrade:\n%s", strings.Join(failures, "\n"))
+		})
+	})
+})
@@ -0,0 +1,202 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+var _ = Describe("E2E - Upgrading Kubernetes on the downstream cluster(s)", Label("upgrade-k8s"), func() {
+	// RKE2 binaries are extracted on all the nodes, servers and agents
+	kubeletVersion := "/var/lib/rancher/rke2/bin/kubelet --version"
+
+	BeforeEach(func() {
+		if cfg.OperatorType != config.OperatorTypeCAPI {
+			Skip("OPERATOR_TYPE is not " + config.OperatorTypeCAPI)
+		}
+		if cfg.K8sDownstreamUpgradeVersion == "" {
+			Skip("K8S_DOWNSTREAM_UPGRADE_VERSION is not set")
+		}
+	})
+
+	// Clients of the downstream clusters, indexed by cluster name
+	// NOTE: the kubeconfig uses a control plane node, so it is only fetched again if this node cannot be reached
+	downstreams := map[string]*elemental.Dynamic{}
+
+	// Nodes of the downstream cluster
+	nodes := func(c config.Cluster) ([]elemental.Node, error) {
+		if downstreams[c.Name] == nil {
+			kubeconfig, err := GetDownstreamKubeconfigE(cfg.ClusterNS, c.Name)
+			if err != nil {
+				return nil, err
+			}
+			downstreams[c.Name] = elemental.NewDynamic(kubeconfig)
+		}
+
+		list := &elemental.NodeList{}
+		if err := downstreams[c.Name].List(elemental.KindNode, "", "", list); err != nil {
+			delete(downstreams, c.Name)
+			return nil, err
+		}
+
+		return list.Items, nil
+	}
+
+	// Node of each Machine of the cluster, indexed by Machine UID
+	machines := func(c config.Cluster) map[string]string {
+		list := &elemental.MachineList{}
+		err := k8s.List(elemental.KindMachine, cfg.ClusterNS, "cluster.x-k8s.io/cluster-name="+c.Name, list)
+		Expect(err).To(Not(HaveOccurred()))
+
+		nodes := map[string]string{}
+		for _, m := range list.Items {
+			if m.Status.NodeRef != nil {
+				nodes[m.Metadata.UID] = m.Status.NodeRef.Name
+			}
+		}
+
+		return nodes
+	}
+
+	// Check that all the nodes of the cluster are Ready and use the new version
+	upgraded := func(c config.Cluster) error {
+		list, err := nodes(c)
+		if err != nil {
+			return err
+		}
+
+		// Replaced nodes are only removed once the new ones are Ready
+		if len(list) != c.Machines() {
+			return fmt.Errorf("%d nodes found, %d expected", len(list), c.Machines())
+		}
+
+		for _, n := range list {
+			if v := n.Status.NodeInfo.KubeletVersion; v != cfg.K8sDownstreamUpgradeVersion {
+				return fmt.Errorf("node %s uses kubelet %s", n.Metadata.Name, v)
+			}
+			ready := ""
+			for _, cond := range n.Status.Conditions {
+				if cond.Type == "Ready" {
+					ready = cond.Status
+				}
+			}
+			if ready != "True" {
+				return fmt.Errorf("node %s is not ready", n.Metadata.Name)
+			}
+		}
+
+		return nil
+	}
+
+	It("Upgrade Kubernetes on the nodes of the downstream cluster(s)", func() {
+		// NOTE: new machines are created before the old ones are deleted,
+		// so the rolling replacement needs a host not used by any cluster
+		used := 0
+		for _, c := range cfg.Clusters() {
+			used += c.Machines()
+		}
+		Expect(cfg.UsedNodes()).To(BeNumerically(">", used), "no spare host for the rolling replacement of the %d machines", used)
+
+		// NOTE: clusters are upgraded one after the other, as rolling replacements use the available hosts
+		for _, c := range cfg.Clusters() {
+			var before, after map[string]string
+			hosts := map[string]elemental.ElementalHost{}
+
+			By("Getting the machines and hosts used by "+c.Name, func() {
+				before = machines(c)
+				Expect(before).To(HaveLen(c.Machines()))
+
+				hostList := &elemental.ElementalHostList{}
+				err := k8s.List(elemental.KindElementalHost, cfg.ClusterNS, "", hostList)
+				Expect(err).To(Not(HaveOccurred()))
+				for _, h := range hostList.Items {
+					hosts[h.Metadata.Name] = h
+				}
+			})
+
+			By("Upgrading the control plane of "+c.Name, func() {
+				out, err := kubectl.RunWithoutErr("get", "cluster",
+					"--namespace", cfg.ClusterNS, c.Name,
+					"-o", "jsonpath={.spec.controlPlaneRef.kind}/{.spec.controlPlaneRef.name}")
+				Expect(err).To(Not(HaveOccurred()))
+
+				_, err = kubectl.RunWithoutErr("patch", strings.ToLower(strings.TrimSpace(out)),
+					"--namespace", cfg.ClusterNS, "--type", "merge",
+					"-p", `{"spec":{"version":"`+cfg.K8sDownstreamUpgradeVersion+`"}}`)
+				Expect(err).To(Not(HaveOccurred()))
+			})
+
+			By("Upgrading the workers of "+c.Name, func() {
+				out, err := kubectl.RunWithoutErr("get", "machinedeployment",
+					"--namespace", cfg.ClusterNS, "--selector", "cluster.x-k8s.io/cluster-name="+c.Name,
+					"-o", "jsonpath={.items[*].metadata.name}")
+				Expect(err).To(Not(HaveOccurred()))
+
+				for _, md := range strings.Fields(out) {
+					_, err := kubectl.RunWithoutErr("patch", "machinedeployment/"+md,
+						"--namespace", cfg.ClusterNS, "--type", "merge",
+						"-p", `{"spec":{"template":{"spec":{"version":"`+cfg.K8sDownstreamUpgradeVersion+`"}}}}`)
+					Expect(err).To(Not(HaveOccurred()))
+				}
+			})
+
+			By("Waiting for all the nodes of "+c.Name+" to use the new kubelet version", func() {
+				// Each node can be replaced, one after the other
+				Eventually(func() error {
+					return upgraded(c)
+				}, tools.SetTimeout(time.Duration(c.Machines())*10*time.Minute), 30*time.Second).Should(Succeed())
+
+				WaitCAPICluster(cfg.ClusterNS, c.Name)
+
+				after = machines(c)
+				Expect(after).To(HaveLen(c.Machines()))
+			})
+
+			By("Checking the kubelet binary on each node of "+c.Name, func() {
+				for _, n := range after {
+					cl, _ := GetNodeInfo(n)
+					out := RunSSHWithRetry(cl, kubeletVersion)
+					Expect(strings.Fields(out)).To(ContainElement(cfg.K8sDownstreamUpgradeVersion), "wrong kubelet binary on %s", n)
+				}
+			})
+
+			By("Checking that replaced hosts of "+c.Name+" are reset and available again", func() {
+				replaced := []string{}
+				for uid, n := range before {
+					if _, ok := after[uid]; !ok {
+						replaced = append(replaced, n)
+					}
+				}
+				slices.Sort(replaced)
+
+				// Nothing is replaced with an in-place upgrade
+				GinkgoWriter.Printf("%d node(s) replaced in %s: %s\n", len(replaced), c.Name, strings.Join(replaced, ", "))
+				for _, h := range replaced {
+					WaitHostReset(cfg.ClusterNS, hosts[h])
+				}
+			})
+		}
+	})
+})
@@ -0,0 +1,162 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+	"github.com/rancher/elemental/tests/e2e/helpers/condition"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+)
+
+var _ = Describe("E2E - Upgrading node", Label("upgrade-node"), func() {
+	var (
+		bootIDs  map[string]string
+		imageURI string
+		mutex    sync.Mutex
+		wg       sync.WaitGroup
+	)
+
+	It("Upgrade node", func() {
+		By("Checking if upgrade OS version is set", func() {
+			Expect(cfg.UpgradeOSVersion).To(Not(BeEmpty()))
+		})
+
+		By("Getting image URI from ManagedOSVersion "+cfg.UpgradeOSVersion, func() {
+			Eventually(func() string {
+				imageURI, _ = elemental.GetImageURI(k8s, cfg.ClusterNS, cfg.UpgradeOSVersion)
+				return imageURI
+			}, tools.SetTimeout(2*time.Minute), 10*time.Second).Should(Not(BeEmpty()))
+		})
+
+		// NOTE: only the nodes used by the machines of the clusters are upgraded
+		var hostNames []string
+		By("Getting the nodes of the cluster(s)", func() {
+			for _, c := range cfg.Clusters() {
+				var nodes []string
+				Eventually(func() error {
+					var err error
+					nodes, err = elemental.GetClusterNodes(k8s, cfg.ClusterNS, c.Name, "")
+					return err
+				}, tools.SetTimeout(2*time.Minute), 10*time.Second).Should(Not(HaveOccurred()))
+				hostNames = append(hostNames, nodes...)
+			}
+		})
+
+		// Save boot IDs to be able to detect the reboot
+		bootIDs = make(map[string]string)
+		for _, hostName := range hostNames {
+			client, _ := GetNodeInfo(hostName)
+			Expect(client).To(Not(BeNil()))
+
+			wg.Add(1)
+			go func(h string, cl *tools.Client) {
+				defer wg.Done()
+				defer GinkgoRecover()
+
+				By("Checking OS version on "+h+" before upgrade", func() {
+					CheckSSH(cl)
+
+					out := RunSSHWithRetry(cl, "cat /etc/os-release")
+					GinkgoWriter.Printf("OS Version on %s:\n%s\n", h, out)
+
+					id := RunSSHWithRetry(cl, "cat /proc/sys/kernel/random/boot_id")
+					mutex.Lock()
+					bootIDs[h] = strings.TrimSpace(id)
+					mutex.Unlock()
+				})
+			}(hostName, client)
+		}
+		wg.Wait()
+
+		By("Triggering upgrade with ManagedOSImage", func() {
+			// One ManagedOSImage per cluster, as it targets a single cluster
+			for _, c := range cfg.Clusters() {
+				// Set temporary file
+				upgradeTmp, err := tools.CreateTemp("managedOSImage")
+				Expect(err).To(Not(HaveOccurred()))
+				defer os.Remove(upgradeTmp)
+
+				upgrade := assets.Template{
+					File:       ws.Asset(osUpgradeYaml),
+					APIVersion: "elemental.cattle.io/v1beta1",
+					Kind:       "ManagedOSImage",
+				}
+				err = upgrade.RenderFile(&assets.Values{
+					ClusterName: c.Name,
+					OSVersion:   cfg.UpgradeOSVersion,
+				}, upgradeTmp)
+				Expect(err).To(Not(HaveOccurred()))
+
+				// Apply to k8s
+				err = kubectl.Apply(cfg.ClusterNS, upgradeTmp)
+				Expect(err).To(Not(HaveOccurred()))
+			}
+		})
+
+		for _, hostName := range hostNames {
+			client, _ := GetNodeInfo(hostName)
+			Expect(client).To(Not(BeNil()))
+
+			wg.Add(1)
+			go func(h, id string, cl *tools.Client) {
+				defer wg.Done()
+				defer GinkgoRecover()
+
+				By("Checking VM upgrade on "+h, func() {
+					// The node must reboot to apply the new image
+					Eventually(func() string {
+						out, _ := cl.RunSSH("cat /proc/sys/kernel/random/boot_id")
+						return strings.TrimSpace(out)
+					}, tools.SetTimeout(20*time.Minute), 30*time.Second).Should(And(Not(BeEmpty()), Not(Equal(id))))
+				})
+
+				By("Checking OS version on "+h+" after upgrade", func() {
+					CheckSSH(cl)
+
+					Eventually(func() string {
+						out, _ := cl.RunSSH("cat /etc/os-release")
+						return out
+					}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring(imageURI))
+
+					out := RunSSHWithRetry(cl, "cat /etc/os-release")
+					GinkgoWriter.Printf("OS Version on %s:\n%s\n", h, out)
+				})
+			}(hostName, bootIDs[hostName], client)
+		}
+		wg.Wait()
+
+		By("Checking elemental hosts status after upgrade", func() {
+			for _, hostName := range hostNames {
+				GinkgoWriter.Printf("Check elementalhost %s\n", hostName)
+				WaitElementalResources(cfg.ClusterNS, condition.ElementalHost, hostName)
+			}
+		})
+
+		By("Checking cluster state after upgrade", func() {
+			for _, c := range cfg.Clusters() {
+				WaitCAPICluster(cfg.ClusterNS, c.Name)
+			}
+		})
+	})
+})
@@ -0,0 +1,185 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/rancher"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/charts"
+	"github.com/rancher/elemental/tests/e2e/helpers/condition"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/elemental"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// helmRelease is the part of a Helm release used by the tests
+type helmRelease struct {
+	Chart      string `json:"chart"`
+	AppVersion string `json:"app_version"`
+}
+
+/*
+Get a deployed Helm release
+  - @param ns Namespace of the release
+  - @param name Name of the release
+  - @returns The release, the function will fail through Ginkgo in case of issue
+*/
+func getHelmRelease(ns, name string) helmRelease {
+	out, err := exec.Command("helm", "list",
+		"--namespace", ns,
+		"--filter", "^"+name+"$",
+		"-o", "json",
+	).Output()
+	Expect(err).To(Not(HaveOccurred()))
+
+	releases := []helmRelease{}
+	err = json.Unmarshal(out, &releases)
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(releases).To(HaveLen(1), "Helm release %s not found", name)
+
+	return releases[0]
+}
+
+var _ = Describe("E2E - Upgrading Elemental Operator", Label("upgrade-operator"), func() {
+	// Create kubectl context
+	// Default timeout is too small, so New() cannot be used
+	k := &kubectl.Kubectl{
+		Namespace:    "",
+		PollTimeout:  tools.SetTimeout(300 * time.Second),
+		PollInterval: 500 * time.Millisecond,
+	}
+
+	BeforeEach(func() {
+		// NOTE: with the CAPI operator the nodes are managed by the Elemental CAPI provider,
+		// its upgrade is tested by the upgrade-capi spec
+		if cfg.OperatorType != config.OperatorTypeVanilla {
+			Skip("OPERATOR_TYPE is not " + config.OperatorTypeVanilla)
+		}
+	})
+
+	It("Upgrade operator and check that nothing changed for the nodes", func() {
+		const (
+			operatorNS      = "cattle-elemental-system"
+			operatorRelease = "elemental-operator"
+		)
+
+		var (
+			before        elemental.Snapshot
+			versionBefore string
+		)
+
+		kinds := []string{
+			elemental.KindMachineRegistration,
+			elemental.KindMachineInventory,
+			elemental.KindManagedOSVersion,
+		}
+
+		By("Taking a snapshot of the Elemental resources", func() {
+			// ElementalHosts only exist if the Elemental CAPI provider is also installed
+			hosts := &elemental.ElementalHostList{}
+			if err := k8s.List(elemental.KindElementalHost, cfg.ClusterNS, "", hosts); err == nil {
+				kinds = append(kinds, elemental.KindElementalHost)
+			} else {
+				Expect(meta.IsNoMatchError(err)).To(BeTrue(), "cannot list ElementalHosts: %v", err)
+			}
+
+			var err error
+			before, err = elemental.TakeSnapshot(k8s, cfg.ClusterNS, kinds...)
+			Expect(err).To(Not(HaveOccurred()))
+
+			// Nodes should already be registered
+			Expect(before.Names(elemental.KindMachineInventory)).To(Not(BeEmpty()))
+
+			versionBefore, err = elemental.GetOperatorVersion(k8s)
+			Expect(err).To(Not(HaveOccurred()))
+			GinkgoWriter.Printf("Elemental operator version before upgrade: %s (chart %s)\n",
+				versionBefore, getHelmRelease(operatorNS, operatorRelease).Chart)
+		})
+
+		By("Upgrading the operator charts to OPERATOR_UPGRADE_VERSION", func() {
+			Expect(cfg.OperatorRepo).To(Not(BeEmpty()), "OPERATOR_REPO is needed to upgrade the operator")
+			Expect(cfg.OperatorUpgradeVersion).To(Not(BeEmpty()), "OPERATOR_UPGRADE_VERSION is needed to upgrade the operator")
+
+			// Installing the same chart again would not test anything
+			Expect(getHelmRelease(operatorNS, operatorRelease).Chart).To(Not(Equal("elemental-operator-chart-"+cfg.OperatorUpgradeVersion)),
+				"elemental-operator-chart %s is already installed", cfg.OperatorUpgradeVersion)
+
+			// Always pull the charts, local archives are the installed ones
+			dir := GinkgoT().TempDir()
+			for _, c := range []string{"elemental-operator-crds", operatorRelease} {
+				chart := charts.Chart{Name: c + "-chart", Repo: cfg.OperatorRepo, Version: cfg.OperatorUpgradeVersion}
+				RunHelmCmdWithRetry(chart.PullArgs(dir)...)
+				archive, err := chart.Find(dir)
+				Expect(err).To(Not(HaveOccurred()))
+
+				RunHelmCmdWithRetry("upgrade", c, archive,
+					"--namespace", operatorNS,
+					"--wait", "--wait-for-jobs",
+				)
+			}
+
+			checkList := [][]string{
+				{operatorNS, "app=elemental-operator"},
+			}
+			Eventually(func() error {
+				return rancher.CheckPod(k, checkList)
+			}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(BeNil())
+		})
+
+		By("Checking the operator version", func() {
+			release := getHelmRelease(operatorNS, operatorRelease)
+			Expect(release.Chart).To(Equal("elemental-operator-chart-" + cfg.OperatorUpgradeVersion))
+
+			// The running operator should be the one of the chart, image tags may not have the "v" prefix
+			Eventually(func() string {
+				v, _ := elemental.GetOperatorVersion(k8s)
+				return strings.TrimPrefix(v, "v")
+			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(Equal(strings.TrimPrefix(release.AppVersion, "v")))
+
+			version, err := elemental.GetOperatorVersion(k8s)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(version).To(Not(Equal(versionBefore)), "Elemental operator version did not change")
+		})
+
+		By("Checking that no Elemental resource was lost or re-created", func() {
+			// Resources could be removed while the new operator reconciles them
+			Consistently(func() error {
+				after, err := elemental.TakeSnapshot(k8s, cfg.ClusterNS, kinds...)
+				if err != nil {
+					return err
+				}
+				return before.Compare(after)
+			}, 2*time.Minute, 20*time.Second).Should(Succeed())
+		})
+
+		By("Checking that the registered nodes are still ready", func() {
+			for _, mi := range before.Names(elemental.KindMachineInventory) {
+				WaitElementalResources(cfg.ClusterNS, condition.MachineInventory, mi)
+			}
+
+			for _, c := range cfg.Clusters() {
+				WaitRancherCluster(cfg.ClusterNS, c.Name)
+			}
+		})
+	})
+})
@@ -0,0 +1,301 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	qaseapi "go.qase.io/client"
+)
+
+// Default Qase API URL
+const defaultAPIURL = "https://api.qase.io/v1"
+
+// api is a minimal Qase API client, payloads use the go.qase.io/client types
+type api struct {
+	url     string
+	token   string
+	project string
+	client  *http.Client
+	// In dry-run mode the requests are only printed on this writer
+	dryRun io.Writer
+}
+
+// response is the envelope of all Qase API responses
+type response struct {
+	Status       bool            `json:"status"`
+	ErrorMessage string          `json:"errorMessage,omitempty"`
+	Result       json.RawMessage `json:"result,omitempty"`
+}
+
+/*
+Create a Qase API client
+  - @param o Options with the API URL, token and project
+  - @param w Writer used to print the requests in dry-run mode
+  - @returns Pointer to the api structure
+*/
+func newAPI(o *options, w io.Writer) *api {
+	a := &api{
+		url:     strings.TrimSuffix(o.url, "/"),
+		token:   o.token,
+		project: o.project,
+		client:  &http.Client{Timeout: 2 * time.Minute},
+	}
+	if o.dryRun {
+		a.dryRun = w
+	}
+
+	return a
+}
+
+/*
+Execute an API request
+  - @param method HTTP method
+  - @param path Path of the endpoint, relative to the API URL
+  - @param contentType Content type of the body
+  - @param body Body of the request, can be nil
+  - @param out Pointer to the structure to decode the result into, can be nil
+  - @returns Nothing or an error
+*/
+func (a *api) do(method, path, contentType string, body io.Reader, out interface{}) error {
+	if a.dryRun != nil {
+		fmt.Fprintf(a.dryRun, "DRY-RUN: %s %s", method, a.url+path)
+		if body != nil && strings.HasPrefix(contentType, "application/json") {
+			data, _ := io.ReadAll(body)
+			fmt.Fprintf(a.dryRun, " %s", data)
+		}
+		fmt.Fprintln(a.dryRun)
+		return nil
+	}
+
+	req, err := http.NewRequest(method, a.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Token", a.token)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	r := &response{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return fmt.Errorf("%s %s: HTTP %d: %s", method, path, resp.StatusCode, bytes.TrimSpace(data))
+	}
+	if resp.StatusCode/100 != 2 || !r.Status {
+		return fmt.Errorf("%s %s: HTTP %d: %s", method, path, resp.StatusCode, r.ErrorMessage)
+	}
+
+	if out == nil || len(r.Result) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(r.Result, out)
+}
+
+// doJSON executes an API request with a JSON body
+func (a *api) doJSON(method, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	return a.do(method, path, "application/json", bytes.NewReader(body), out)
+}
+
+/*
+Create a run
+  - @param r Run to create
+  - @returns The ID of the run or an error
+*/
+func (a *api) createRun(r qaseapi.RunCreate) (int64, error) {
+	result := &qaseapi.IdResponseResult{}
+	if err := a.doJSON(http.MethodPost, "/run/"+a.project, r, result); err != nil {
+		return 0, err
+	}
+
+	return result.Id, nil
+}
+
+/*
+Delete a run
+  - @param id ID of the run
+  - @returns Nothing or an error
+*/
+func (a *api) deleteRun(id int64) error {
+	return a.do(http.MethodDelete, "/run/"+a.project+"/"+strconv.FormatInt(id, 10), "", nil, nil)
+}
+
+/*
+Mark a run as complete
+  - @param id ID of the run
+  - @returns Nothing or an error
+*/
+func (a *api) completeRun(id int64) error {
+	return a.do(http.MethodPost, "/run/"+a.project+"/"+strconv.FormatInt(id, 10)+"/complete", "", nil, nil)
+}
+
+/*
+Make the report of a run public
+  - @param id ID of the run
+  - @returns The URL of the public report or an error
+*/
+func (a *api) publishRun(id int64) (string, error) {
+	result := &qaseapi.RunPublicResponseResult{}
+	path := "/run/" + a.project + "/" + strconv.FormatInt(id, 10) + "/public"
+	if err := a.doJSON(http.MethodPatch, path, qaseapi.RunPublic{Status: true}, result); err != nil {
+		return "", err
+	}
+
+	return result.Url, nil
+}
+
+/*
+List the runs of the project
+  - @param status Filter on the status of the runs (active, complete, abort), all runs if empty
+  - @returns The list of runs or an error
+*/
+func (a *api) listRuns(status string) ([]qaseapi.Run, error) {
+	q := url.Values{}
+	q.Set("limit", "100")
+	if status != "" {
+		q.Set("filters[status]", status)
+	}
+
+	result := &qaseapi.RunListResponseResult{}
+	if err := a.do(http.MethodGet, "/run/"+a.project+"?"+q.Encode(), "", nil, result); err != nil {
+		return nil, err
+	}
+
+	return result.Entities, nil
+}
+
+/*
+Get a run
+  - @param id ID of the run
+  - @returns The run, including its statistics, or an error
+*/
+func (a *api) getRun(id int64) (*qaseapi.Run, error) {
+	run := &qaseapi.Run{}
+	if err := a.do(http.MethodGet, "/run/"+a.project+"/"+strconv.FormatInt(id, 10), "", nil, run); err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+/*
+Upload files as attachments of the project
+  - @param files List of files to upload
+  - @returns The uploaded attachments or an error
+*/
+func (a *api) uploadAttachments(files []string) ([]qaseapi.AttachmentGet, error) {
+	var body bytes.Buffer
+
+	w := multipart.NewWriter(&body)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		part, err := w.CreateFormFile("file", filepath.Base(file))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	var result []qaseapi.AttachmentGet
+	if err := a.do(http.MethodPost, "/attachment/"+a.project, w.FormDataContentType(), &body, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+Add results in a run
+  - @param id ID of the run
+  - @param results Results to add
+  - @returns Nothing or an error
+*/
+func (a *api) createResults(id int64, results []qaseapi.ResultCreate) error {
+	path := "/result/" + a.project + "/" + strconv.FormatInt(id, 10) + "/bulk"
+
+	return a.doJSON(http.MethodPost, path, qaseapi.ResultCreateBulk{Results: results}, nil)
+}
+
+/*
+List the results of a run
+  - @param id ID of the run
+  - @param caseID Only get the results of this case, all if 0
+  - @returns The list of results or an error
+*/
+func (a *api) listResults(id, caseID int64) ([]qaseapi.Result, error) {
+	q := url.Values{}
+	q.Set("limit", "100")
+	q.Set("filters[run]", strconv.FormatInt(id, 10))
+	if caseID > 0 {
+		q.Set("filters[case_id]", strconv.FormatInt(caseID, 10))
+	}
+
+	result := &qaseapi.ResultListResponseResult{}
+	if err := a.do(http.MethodGet, "/result/"+a.project+"?"+q.Encode(), "", nil, result); err != nil {
+		return nil, err
+	}
+
+	return result.Entities, nil
+}
+
+/*
+Update a result of a run
+  - @param id ID of the run
+  - @param hash Hash of the result
+  - @param r Fields to update
+  - @returns Nothing or an error
+*/
+func (a *api) updateResult(id int64, hash string, r qaseapi.ResultUpdate) error {
+	path := "/result/" + a.project + "/" + strconv.FormatInt(id, 10) + "/" + hash
+
+	return a.doJSON(http.MethodPatch, path, r, nil)
+}
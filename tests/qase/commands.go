@@ -0,0 +1,457 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rancher/elemental/tests/qase/report"
+	"github.com/sirupsen/logrus"
+	qaseapi "go.qase.io/client"
+)
+
+// options shared by all the subcommands, flags take precedence over env vars
+type options struct {
+	url     string
+	token   string
+	project string
+	runID   int64
+	dryRun  bool
+}
+
+// command is a subcommand of the CLI
+type command struct {
+	usage string
+	run   func(o *options, fs *flag.FlagSet, args []string, w io.Writer) error
+}
+
+// commands lists the available subcommands
+var commands = map[string]command{
+	"attach":  {usage: "upload files and attach them to the results of a run", run: attachCmd},
+	"create":  {usage: "create a run and print its id", run: createCmd},
+	"delete":  {usage: "delete a run", run: deleteCmd},
+	"list":    {usage: "list the runs of the project", run: listCmd},
+	"publish": {usage: "complete a run and/or publish its report", run: publishCmd},
+	"status":  {usage: "show the status and the case counts of a run", run: statusCmd},
+	"upload":  {usage: "add results in a run from a Ginkgo JSON or JUnit report", run: uploadCmd},
+}
+
+/*
+Create the flag set of a subcommand, with the shared options
+  - @param name Name of the subcommand
+  - @param o Options to fill
+  - @returns Pointer to the flag set
+*/
+func newFlagSet(name string, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	runID, _ := strconv.ParseInt(os.Getenv("QASE_RUN_ID"), 10, 64)
+	fs.StringVar(&o.url, "api-url", envOr("QASE_API_URL", defaultAPIURL), "Qase API URL (QASE_API_URL)")
+	fs.StringVar(&o.token, "token", os.Getenv("QASE_API_TOKEN"), "Qase API token (QASE_API_TOKEN)")
+	fs.StringVar(&o.project, "project", os.Getenv("QASE_PROJECT_CODE"), "Qase project code (QASE_PROJECT_CODE)")
+	fs.Int64Var(&o.runID, "run", runID, "Qase run id (QASE_RUN_ID)")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "only print the API calls")
+
+	return fs
+}
+
+// envOr returns the value of an env var or a default value if not set
+func envOr(key, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return value
+}
+
+/*
+Check the shared options
+  - @param o Options to check
+  - @param needRun True if a run id is needed
+  - @returns Nothing or an error with all the missing options
+*/
+func (o *options) validate(needRun bool) error {
+	var errs []error
+
+	if o.token == "" {
+		errs = append(errs, errors.New("token is missing (-token or QASE_API_TOKEN)"))
+	}
+	if o.project == "" {
+		errs = append(errs, errors.New("project is missing (-project or QASE_PROJECT_CODE)"))
+	}
+	if needRun && o.runID <= 0 {
+		errs = append(errs, errors.New("run id is missing (-run or QASE_RUN_ID)"))
+	}
+
+	return errors.Join(errs...)
+}
+
+/*
+Check if there is a run to work on, the CI calls the commands even when no run was created
+  - @param o Options to check
+  - @param name Name of the subcommand, for the log
+  - @returns True if there is nothing to do
+*/
+func (o *options) noRun(name string) bool {
+	if o.runID > 0 {
+		return false
+	}
+	logrus.Infof("No run id (-run or QASE_RUN_ID), nothing to %s", name)
+
+	return true
+}
+
+/*
+Execute a subcommand
+  - @param name Name of the subcommand
+  - @param args Arguments of the subcommand
+  - @param w Writer for the output
+  - @returns Nothing or an error
+*/
+func runCommand(name string, args []string, w io.Writer) error {
+	c, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q, available commands: %s", name, strings.Join(commandNames(), ", "))
+	}
+
+	o := &options{}
+	fs := newFlagSet(name, o)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s: %s\n", name, c.usage)
+		fs.PrintDefaults()
+	}
+
+	return c.run(o, fs, args, w)
+}
+
+// commandNames returns the sorted names of the subcommands
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for n := range commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// createCmd creates a run
+func createCmd(o *options, fs *flag.FlagSet, args []string, w io.Writer) error {
+	envID, _ := strconv.ParseInt(os.Getenv("QASE_ENVIRONMENT_ID"), 10, 64)
+	name := fs.String("name", os.Getenv("QASE_RUN_NAME"), "name of the run (QASE_RUN_NAME)")
+	description := fs.String("description", envOr("QASE_RUN_DESCRIPTION", "Ginkgo automated run"), "description of the run (QASE_RUN_DESCRIPTION)")
+	environment := fs.Int64("environment", envID, "id of the environment of the run (QASE_ENVIRONMENT_ID)")
+	jsonOutput := fs.Bool("json", false, "print the created run in JSON format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := o.validate(false); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		*name = "Automated run " + time.Now().Format(time.RFC3339)
+	}
+	r := qaseapi.RunCreate{
+		Title:         *name,
+		Description:   *description,
+		IsAutotest:    true,
+		EnvironmentId: *environment,
+	}
+
+	a := newAPI(o, w)
+	id, err := a.createRun(r)
+	if err != nil {
+		return err
+	}
+	if id <= 0 && !o.dryRun {
+		return errors.New("no id returned for the created run")
+	}
+
+	if !*jsonOutput {
+		fmt.Fprintf(w, "%d", id)
+		return nil
+	}
+
+	// Get the run as created by Qase
+	run := &qaseapi.Run{Id: id, Title: r.Title, Description: r.Description}
+	if !o.dryRun {
+		if run, err = a.getRun(id); err != nil {
+			return err
+		}
+	}
+
+	return printJSON(w, run)
+}
+
+// deleteCmd deletes a run
+func deleteCmd(o *options, fs *flag.FlagSet, args []string, w io.Writer) error {
+	jsonOutput := fs.Bool("json", false, "print the result in JSON format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := o.validate(false); err != nil {
+		return err
+	}
+	if o.noRun("delete") {
+		return nil
+	}
+
+	if err := newAPI(o, w).deleteRun(o.runID); err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		return printJSON(w, map[string]interface{}{"id": o.runID, "deleted": true})
+	}
+	fmt.Fprintf(w, "Run %d deleted\n", o.runID)
+
+	return nil
+}
+
+// publishCmd completes a run and publishes its report
+func publishCmd(o *options, fs *flag.FlagSet, args []string, w io.Writer) error {
+	complete := fs.Bool("complete", os.Getenv("QASE_RUN_COMPLETE") != "", "mark the run as complete (QASE_RUN_COMPLETE)")
+	public := fs.Bool("public", os.Getenv("QASE_REPORT") != "", "make the report public (QASE_REPORT)")
+	jsonOutput := fs.Bool("json", false, "print the result in JSON format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := o.validate(false); err != nil {
+		return err
+	}
+	if o.noRun("publish") {
+		return nil
+	}
+	if !*complete && !*public {
+		logrus.Infof("Nothing to publish for run ID %d, -complete and/or -public are not set", o.runID)
+		return nil
+	}
+
+	a := newAPI(o, w)
+	if *complete {
+		if err := a.completeRun(o.runID); err != nil {
+			return err
+		}
+	}
+
+	var url string
+	if *public {
+		var err error
+		if url, err = a.publishRun(o.runID); err != nil {
+			return err
+		}
+	}
+
+	if *jsonOutput {
+		return printJSON(w, map[string]interface{}{"id": o.runID, "completed": *complete, "url": url})
+	}
+	if *complete {
+		fmt.Fprintf(w, "Report for run ID %d has been complete\n", o.runID)
+	}
+	if url != "" {
+		// NOTE: the CI extracts the URL from this line
+		fmt.Fprintf(w, "Report for run ID %d available: %s\n", o.runID, url)
+	}
+
+	return nil
+}
+
+// printJSON prints a value in indented JSON format
+func printJSON(w io.Writer, v interface{}) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+
+	return e.Encode(v)
+}
+
+// listCmd lists the runs of the project
+func listCmd(o *options, fs *flag.FlagSet, args []string, w io.Writer) error {
+	status := fs.String("status", "active", "only list the runs with this status (active, complete, abort), all if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := o.validate(false); err != nil {
+		return err
+	}
+
+	runs, err := newAPI(o, w).listRuns(*status)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tTITLE")
+	for _, r := range runs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", r.Id, r.StatusText, r.Title)
+	}
+
+	return tw.Flush()
+}
+
+// statusCmd shows the status of a run
+func statusCmd(o *options, fs *flag.FlagSet, args []string, w io.Writer) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := o.validate(true); err != nil {
+		return err
+	}
+
+	run, err := newAPI(o, w).getRun(o.runID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Run %d: %s\nStatus: %s\n", run.Id, run.Title, run.StatusText)
+	if s := run.Stats; s != nil {
+		fmt.Fprintf(w, "Total: %d\nPassed: %d\nFailed: %d\nBlocked: %d\nSkipped: %d\nUntested: %d\nIn progress: %d\n",
+			s.Total, s.Passed, s.Failed, s.Blocked, s.Skipped, s.Untested, s.InProgress)
+	}
+
+	return nil
+}
+
+// attachCmd uploads files and attaches them to the results of a run
+func attachCmd(o *options, fs *flag.FlagSet, args []string, w io.Writer) error {
+	caseID := fs.Int64("case", 0, "only attach the files to the results of this case")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := o.validate(false); err != nil {
+		return err
+	}
+	if o.noRun("attach") {
+		return nil
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no file to attach")
+	}
+
+	a := newAPI(o, w)
+	hashes, err := upload(a, fs.Args(), w)
+	if err != nil {
+		return err
+	}
+
+	results, err := a.listResults(o.runID, *caseID)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no result in run %d to attach the files to", o.runID)
+	}
+
+	for _, r := range results {
+		if err := a.updateResult(o.runID, r.Hash, qaseapi.ResultUpdate{Attachments: hashes}); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Attached to result %s (case %d)\n", r.Hash, r.CaseId)
+	}
+
+	return nil
+}
+
+// uploadCmd adds results in a run from a Ginkgo report
+func uploadCmd(o *options, fs *flag.FlagSet, args []string, w io.Writer) error {
+	var attachments stringList
+	fs.Var(&attachments, "attach", "file to attach to all the results, can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := o.validate(false); err != nil {
+		return err
+	}
+	if o.noRun("upload") {
+		return nil
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no report to upload")
+	}
+
+	var results []qaseapi.ResultCreate
+	for _, file := range fs.Args() {
+		r, err := readReport(file)
+		if err != nil {
+			return err
+		}
+		results = append(results, r...)
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no result with a %s report entry found", report.CaseIDEntry)
+	}
+
+	a := newAPI(o, w)
+	if len(attachments) > 0 {
+		hashes, err := upload(a, attachments, w)
+		if err != nil {
+			return err
+		}
+		for i := range results {
+			results[i].Attachments = hashes
+		}
+	}
+
+	if err := a.createResults(o.runID, results); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d results added in run %d\n", len(results), o.runID)
+
+	return nil
+}
+
+/*
+Upload attachments
+  - @param a Qase API client
+  - @param files Files to upload
+  - @param w Writer for the output
+  - @returns The hashes of the attachments or an error
+*/
+func upload(a *api, files []string, w io.Writer) ([]string, error) {
+	attachments, err := a.uploadAttachments(files)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(attachments))
+	for _, at := range attachments {
+		hashes = append(hashes, at.Hash)
+		fmt.Fprintf(w, "Uploaded %s: %s\n", at.File, at.FullPath)
+	}
+
+	return hashes, nil
+}
+
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
@@ -15,54 +15,75 @@ limitations under the License.
 package main
 
 import (
-	"flag"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"strings"
 
-	qase "github.com/rancher-sandbox/qase-ginkgo"
 	"github.com/sirupsen/logrus"
 )
 
-var (
-	runID    int32
-	runStrID = os.Getenv("QASE_RUN_ID")
-)
+// Legacy options, kept for compatibility with the existing pipelines
+var legacyOptions = []string{"create", "delete", "publish"}
 
-func init() {
-	if runStrID != "" {
-		i, err := strconv.ParseInt(runStrID, 10, 32)
-		if err != nil {
-			logrus.Fatalf("Error on converting string to int64: %v", err)
-		}
-		runID = int32(i)
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		logrus.Fatalln(err)
 	}
 }
 
-func main() {
-	// Define the allowed options
-	createRun := flag.Bool("create", false, "create a new Qase run")
-	deleteRun := flag.Bool("delete", false, "delete a Qase run, QASE_RUN_ID should be set")
-	publishRun := flag.Bool("publish", false, "publish a Qase report, QASE_RUN_ID should be set, it also depends on QASE_REPORT and QASE_RUN_COMPLETE")
+/*
+Execute the CLI
+  - @param args Command line arguments, without the program name
+  - @param w Writer for the output
+  - @returns Nothing or an error, the program exits with a non-zero code in that case
+*/
+func run(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return usageError()
+	}
+
+	// Subcommand style: qase_cmd <command> [options]
+	if !strings.HasPrefix(args[0], "-") {
+		return runCommand(args[0], args[1:], w)
+	}
 
-	// Parse the arguments
-	flag.Parse()
+	// Option style: qase_cmd -<command> [options]
+	var (
+		selected []string
+		rest     []string
+	)
+	for _, a := range args {
+		if name := strings.TrimLeft(a, "-"); contains(legacyOptions, name) {
+			selected = append(selected, name)
+			continue
+		}
+		rest = append(rest, a)
+	}
 
-	// Only one option at a time is allowed
-	if *createRun {
-		id := qase.CreateRun()
-		if id <= 0 {
-			logrus.Fatalln("Error on creating Qase run")
+	switch len(selected) {
+	case 0:
+		return usageError()
+	case 1:
+		return runCommand(selected[0], rest, w)
+	}
+
+	return fmt.Errorf("options -%s are mutually exclusive", strings.Join(selected, ", -"))
+}
+
+// usageError returns the error listing the available commands
+func usageError() error {
+	return errors.New("a command is needed: " + strings.Join(commandNames(), ", "))
+}
+
+// contains returns true if the value is in the list
+func contains(list []string, v string) bool {
+	for _, l := range list {
+		if l == v {
+			return true
 		}
-		logrus.Debugf("Qase run id %d created", id)
-		fmt.Printf("%d", id)
-	} else if *deleteRun {
-		qase.DeleteRun()
-		logrus.Debugf("Qase run id %d deleted", runID)
-	} else if *publishRun {
-		qase.FinalizeResults()
-		logrus.Debugf("Qase finalization for run id %d has been done", runID)
-	} else {
-		logrus.Debugln("Nothing to do!")
 	}
+
+	return false
 }
@@ -0,0 +1,344 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// request received by the Qase API stub
+type request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+	Files  []string
+}
+
+// stub is a minimal Qase API server
+type stub struct {
+	*httptest.Server
+	requests []request
+	// Result returned by path (method and path, without query)
+	results map[string]string
+	mutex   sync.Mutex
+}
+
+func newStub() *stub {
+	s := &stub{results: make(map[string]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer GinkgoRecover()
+
+		Expect(r.Header.Get("Token")).To(Equal("secret"))
+
+		req := request{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query().Encode()}
+		if mt, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+			mr := multipart.NewReader(r.Body, params["boundary"])
+			for {
+				p, err := mr.NextPart()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).To(Not(HaveOccurred()))
+				req.Files = append(req.Files, p.FileName())
+			}
+		} else {
+			body, _ := io.ReadAll(r.Body)
+			req.Body = string(body)
+		}
+
+		s.mutex.Lock()
+		s.requests = append(s.requests, req)
+		result, ok := s.results[r.Method+" "+r.URL.Path]
+		s.mutex.Unlock()
+
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"status": false, "errorMessage": "Not found"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status": true, "result": %s}`, result)
+	}))
+
+	return s
+}
+
+// run executes a subcommand against the stub
+func (s *stub) run(name string, args ...string) (string, error) {
+	var out bytes.Buffer
+	args = append([]string{"-api-url", s.URL, "-token", "secret", "-project", "ELEMENTAL"}, args...)
+	err := runCommand(name, args, &out)
+
+	return out.String(), err
+}
+
+// results returns the results sent in a bulk request
+func (r request) results() []map[string]interface{} {
+	var bulk struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	Expect(json.Unmarshal([]byte(r.Body), &bulk)).To(Succeed())
+
+	return bulk.Results
+}
+
+const jsonReport = `[{
+  "SuiteDescription": "Elemental End-To-End Test Suite",
+  "SpecReports": [
+    {
+      "ContainerHierarchyTexts": ["E2E - Bootstrapping node"],
+      "LeafNodeType": "It",
+      "LeafNodeText": "Provision the node",
+      "State": "passed",
+      "RunTime": 1500000000,
+      "ReportEntries": [{"Name": "QaseCaseID", "Value": {"Representation": "9", "AsJSON": "9"}}]
+    },
+    {
+      "ContainerHierarchyTexts": ["E2E - Bootstrapping node"],
+      "LeafNodeType": "It",
+      "LeafNodeText": "Add the nodes in the cluster",
+      "State": "failed",
+      "Failure": {"Message": "timed out"},
+      "ReportEntries": [{"Name": "QaseCaseID", "Value": {"Representation": "10", "AsJSON": "10"}}]
+    },
+    {
+      "LeafNodeType": "It",
+      "LeafNodeText": "Without case",
+      "State": "passed"
+    },
+    {
+      "LeafNodeType": "BeforeSuite",
+      "State": "passed"
+    }
+  ]
+}]`
+
+const junitReport = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="2" failures="1">
+  <testsuite name="Elemental End-To-End Test Suite" tests="2" failures="1">
+    <testcase name="[It] E2E - Reset node Reset one node [reset]" status="failed" time="62.5">
+      <failure message="node not reset" type="failed"></failure>
+      <system-err>  STEP: Resetting node
+  QaseCaseID - /tests/e2e/suite_test.go:352 @ 10/17/26 03:19:09.47
+    71
+</system-err>
+    </testcase>
+    <testcase name="[BeforeSuite]" status="passed" time="1"></testcase>
+  </testsuite>
+</testsuites>`
+
+var _ = Describe("Qase CLI", func() {
+	var s *stub
+
+	BeforeEach(func() {
+		s = newStub()
+		DeferCleanup(s.Close)
+		GinkgoT().Setenv("QASE_RUN_ID", "")
+	})
+
+	It("lists the active runs", func() {
+		s.results["GET /run/ELEMENTAL"] = `{"entities": [{"id": 12, "title": "Nightly", "status_text": "active"}]}`
+
+		out, err := s.run("list")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(out).To(MatchRegexp(`12\s+active\s+Nightly`))
+		Expect(s.requests[0].Query).To(ContainSubstring("filters%5Bstatus%5D=active"))
+	})
+
+	It("shows the status of a run", func() {
+		s.results["GET /run/ELEMENTAL/12"] = `{"id": 12, "title": "Nightly", "status_text": "complete",
+			"stats": {"total": 5, "passed": 3, "failed": 1, "skipped": 1}}`
+
+		out, err := s.run("status", "-run", "12")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(out).To(ContainSubstring("Status: complete"))
+		Expect(out).To(ContainSubstring("Passed: 3"))
+		Expect(out).To(ContainSubstring("Failed: 1"))
+	})
+
+	It("takes the run id from the environment", func() {
+		GinkgoT().Setenv("QASE_RUN_ID", "13")
+
+		_, err := s.run("status")
+		Expect(err).To(MatchError(ContainSubstring("HTTP 404: Not found")))
+		Expect(s.requests[0].Path).To(Equal("/run/ELEMENTAL/13"))
+	})
+
+	It("fails without mandatory options", func() {
+		err := runCommand("status", []string{"-api-url", s.URL}, io.Discard)
+		Expect(err).To(MatchError(ContainSubstring("token is missing")))
+		Expect(err).To(MatchError(ContainSubstring("project is missing")))
+		Expect(err).To(MatchError(ContainSubstring("run id is missing")))
+		Expect(s.requests).To(BeEmpty())
+
+		Expect(runCommand("unknown", nil, io.Discard)).To(MatchError(ContainSubstring("available commands")))
+	})
+
+	It("uploads results from a JSON report", func() {
+		report := filepath.Join(GinkgoT().TempDir(), "report.json")
+		Expect(os.WriteFile(report, []byte(jsonReport), 0644)).To(Succeed())
+		s.results["POST /result/ELEMENTAL/12/bulk"] = `{}`
+
+		out, err := s.run("upload", "-run", "12", report)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(out).To(ContainSubstring("2 results added in run 12"))
+
+		results := s.requests[0].results()
+		Expect(results).To(HaveLen(2))
+		Expect(results[0]).To(HaveKeyWithValue("case_id", BeEquivalentTo(9)))
+		Expect(results[0]).To(HaveKeyWithValue("status", "passed"))
+		Expect(results[0]).To(HaveKeyWithValue("time_ms", BeEquivalentTo(1500)))
+		Expect(results[1]).To(HaveKeyWithValue("case_id", BeEquivalentTo(10)))
+		Expect(results[1]).To(HaveKeyWithValue("status", "failed"))
+		Expect(results[1]).To(HaveKeyWithValue("stacktrace", "timed out"))
+	})
+
+	It("uploads results from a JUnit report with attachments", func() {
+		dir := GinkgoT().TempDir()
+		report := filepath.Join(dir, "report.xml")
+		Expect(os.WriteFile(report, []byte(junitReport), 0644)).To(Succeed())
+		logs := filepath.Join(dir, "logs.tar.gz")
+		Expect(os.WriteFile(logs, []byte("logs"), 0644)).To(Succeed())
+		s.results["POST /attachment/ELEMENTAL"] = `[{"hash": "abc", "file": "logs.tar.gz", "full_path": "https://qase/abc"}]`
+		s.results["POST /result/ELEMENTAL/12/bulk"] = `{}`
+
+		_, err := s.run("upload", "-run", "12", "-attach", logs, report)
+		Expect(err).To(Not(HaveOccurred()))
+
+		Expect(s.requests[0].Files).To(Equal([]string{"logs.tar.gz"}))
+		results := s.requests[1].results()
+		Expect(results).To(HaveLen(1))
+		Expect(results[0]).To(HaveKeyWithValue("case_id", BeEquivalentTo(71)))
+		Expect(results[0]).To(HaveKeyWithValue("status", "failed"))
+		Expect(results[0]).To(HaveKeyWithValue("attachments", ConsistOf("abc")))
+	})
+
+	It("attaches files to the results of a run", func() {
+		logs := filepath.Join(GinkgoT().TempDir(), "logs.tar.gz")
+		Expect(os.WriteFile(logs, []byte("logs"), 0644)).To(Succeed())
+		s.results["POST /attachment/ELEMENTAL"] = `[{"hash": "abc", "file": "logs.tar.gz", "full_path": "https://qase/abc"}]`
+		s.results["GET /result/ELEMENTAL"] = `{"entities": [{"hash": "r1", "case_id": 9}, {"hash": "r2", "case_id": 10}]}`
+		s.results["PATCH /result/ELEMENTAL/12/r1"] = `{}`
+		s.results["PATCH /result/ELEMENTAL/12/r2"] = `{}`
+
+		out, err := s.run("attach", "-run", "12", logs)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(out).To(ContainSubstring("https://qase/abc"))
+		Expect(s.requests[1].Query).To(ContainSubstring("filters%5Brun%5D=12"))
+		Expect(s.requests[2].Body).To(ContainSubstring(`"attachments":["abc"]`))
+		Expect(strings.Count(out, "Attached to result")).To(Equal(2))
+	})
+
+	Describe("Run management", func() {
+		BeforeEach(func() {
+			for _, e := range []string{"QASE_RUN_NAME", "QASE_RUN_DESCRIPTION", "QASE_ENVIRONMENT_ID", "QASE_RUN_COMPLETE", "QASE_REPORT"} {
+				GinkgoT().Setenv(e, "")
+			}
+		})
+
+		It("rejects conflicting or missing commands", func() {
+			err := run([]string{"-create", "-publish"}, io.Discard)
+			Expect(err).To(MatchError("options -create, -publish are mutually exclusive"))
+
+			Expect(run(nil, io.Discard)).To(MatchError(ContainSubstring("a command is needed")))
+			Expect(run([]string{"-dry-run"}, io.Discard)).To(MatchError(ContainSubstring("a command is needed")))
+			Expect(s.requests).To(BeEmpty())
+		})
+
+		It("creates a run with the legacy option", func() {
+			s.results["POST /run/ELEMENTAL"] = `{"id": 42}`
+
+			var out bytes.Buffer
+			err := run([]string{"-create", "-api-url", s.URL, "-token", "secret", "-project", "ELEMENTAL", "-name", "Nightly"}, &out)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(out.String()).To(Equal("42"))
+			Expect(s.requests[0].Body).To(ContainSubstring(`"title":"Nightly"`))
+			Expect(s.requests[0].Body).To(ContainSubstring(`"is_autotest":true`))
+		})
+
+		It("prints the created run in JSON format", func() {
+			s.results["POST /run/ELEMENTAL"] = `{"id": 42}`
+			s.results["GET /run/ELEMENTAL/42"] = `{"id": 42, "title": "Nightly", "status_text": "active"}`
+
+			out, err := s.run("create", "-name", "Nightly", "-json")
+			Expect(err).To(Not(HaveOccurred()))
+
+			created := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(out), &created)).To(Succeed())
+			Expect(created).To(HaveKeyWithValue("id", BeEquivalentTo(42)))
+			Expect(created).To(HaveKeyWithValue("status_text", "active"))
+		})
+
+		It("only prints the API calls in dry-run mode", func() {
+			out, err := s.run("create", "-name", "Nightly", "-dry-run")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(out).To(ContainSubstring("DRY-RUN: POST " + s.URL + "/run/ELEMENTAL {"))
+			Expect(out).To(ContainSubstring(`"title":"Nightly"`))
+
+			out, err = s.run("publish", "-run", "42", "-complete", "-public", "-dry-run")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(out).To(ContainSubstring("DRY-RUN: POST " + s.URL + "/run/ELEMENTAL/42/complete"))
+			Expect(out).To(ContainSubstring("DRY-RUN: PATCH " + s.URL + "/run/ELEMENTAL/42/public"))
+
+			Expect(s.requests).To(BeEmpty())
+		})
+
+		It("fails if the API call fails", func() {
+			_, err := s.run("delete", "-run", "42")
+			Expect(err).To(MatchError(ContainSubstring("DELETE /run/ELEMENTAL/42: HTTP 404")))
+
+		})
+
+		It("does nothing without a run or anything to publish", func() {
+			out, err := s.run("publish", "-run", "42")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(out).To(BeEmpty())
+
+			GinkgoT().Setenv("QASE_RUN_COMPLETE", "1")
+			for _, cmd := range []string{"delete", "publish", "upload", "attach"} {
+				out, err = s.run(cmd, "report.json")
+				Expect(err).To(Not(HaveOccurred()))
+				Expect(out).To(BeEmpty())
+			}
+
+			Expect(s.requests).To(BeEmpty())
+		})
+
+		It("publishes the report", func() {
+			GinkgoT().Setenv("QASE_RUN_COMPLETE", "1")
+			GinkgoT().Setenv("QASE_REPORT", "1")
+			s.results["POST /run/ELEMENTAL/42/complete"] = `{}`
+			s.results["PATCH /run/ELEMENTAL/42/public"] = `{"url": "https://qase/public/42"}`
+
+			out, err := s.run("publish", "-run", "42")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(out).To(ContainSubstring("Report for run ID 42 available: https://qase/public/42"))
+		})
+	})
+})
@@ -0,0 +1,144 @@
+/*
+Copyright © 2022 - 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2/reporters"
+	"github.com/onsi/ginkgo/v2/types"
+	"github.com/rancher/elemental/tests/qase/report"
+	qaseapi "go.qase.io/client"
+)
+
+// Report entries are rendered in the JUnit timeline as "Name - location" followed by the value
+var junitCaseID = regexp.MustCompile(`(?m)^\s*` + report.CaseIDEntry + ` - .*\n\s*(\d+)\s*$`)
+
+/*
+Convert a Ginkgo state into a Qase result status
+  - @param state Ginkgo spec state, as a string
+  - @returns The Qase status
+*/
+func qaseStatus(state string) string {
+	switch state {
+	case "passed":
+		return "passed"
+	case "skipped", "pending":
+		return "skipped"
+	default:
+		// failed, timedout, panicked, interrupted, aborted
+		return "failed"
+	}
+}
+
+/*
+Read the results of a Ginkgo report, specs without case ID are ignored
+  - @param file Ginkgo report, JSON (--json-report) or JUnit (--junit-report) format
+  - @returns The list of results or an error
+*/
+func readReport(file string) ([]qaseapi.ResultCreate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return readJSONReport(data)
+	case ".xml":
+		return readJUnitReport(data)
+	}
+
+	return nil, fmt.Errorf("unknown report format for %s, json or xml expected", file)
+}
+
+// readJSONReport reads the results from a Ginkgo JSON report
+func readJSONReport(data []byte) ([]qaseapi.ResultCreate, error) {
+	var reports []types.Report
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return nil, err
+	}
+
+	var results []qaseapi.ResultCreate
+	for _, r := range reports {
+		for _, s := range r.SpecReports {
+			if s.LeafNodeType != types.NodeTypeIt {
+				continue
+			}
+
+			var id int64
+			for _, e := range s.ReportEntries {
+				if e.Name == report.CaseIDEntry {
+					id, _ = strconv.ParseInt(e.StringRepresentation(), 10, 64)
+				}
+			}
+			if id <= 0 {
+				continue
+			}
+
+			results = append(results, qaseapi.ResultCreate{
+				CaseId:     id,
+				Status:     qaseStatus(s.State.String()),
+				TimeMs:     s.RunTime.Milliseconds(),
+				Comment:    s.FullText(),
+				Stacktrace: s.Failure.Message,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// readJUnitReport reads the results from a Ginkgo JUnit report
+func readJUnitReport(data []byte) ([]qaseapi.ResultCreate, error) {
+	suites := reporters.JUnitTestSuites{}
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		return nil, err
+	}
+
+	var results []qaseapi.ResultCreate
+	for _, suite := range suites.TestSuites {
+		for _, tc := range suite.TestCases {
+			m := junitCaseID.FindStringSubmatch(tc.SystemErr)
+			if m == nil {
+				continue
+			}
+			id, _ := strconv.ParseInt(m[1], 10, 64)
+			if id <= 0 {
+				continue
+			}
+
+			r := qaseapi.ResultCreate{
+				CaseId:  id,
+				Status:  qaseStatus(tc.Status),
+				TimeMs:  int64(tc.Time * 1000),
+				Comment: tc.Name,
+			}
+			if tc.Failure != nil {
+				r.Stacktrace = tc.Failure.Message
+			}
+			results = append(results, r)
+		}
+	}
+
+	return results, nil
+}